@@ -0,0 +1,114 @@
+// Package bookmark stores named positions within tracks, persisted to
+// $XDG_DATA_HOME/cliamp/bookmarks.json.
+package bookmark
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"cliamp/config"
+	"cliamp/playlist"
+)
+
+// Bookmark is a named position within a track.
+type Bookmark struct {
+	Name     string        `json:"name"`
+	Position time.Duration `json:"position"`
+}
+
+// Store holds bookmarks for all tracks, keyed by playlist.Track.Key.
+type Store struct {
+	path  string
+	marks map[string][]Bookmark
+}
+
+// Load reads the bookmark file. Returns an empty store if it does not exist.
+func Load() (*Store, error) {
+	path, err := config.File(config.DataDir, "bookmarks.json")
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		path:  path,
+		marks: make(map[string][]Bookmark),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return s, nil
+		}
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s.marks); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// List returns the bookmarks for a track, ordered by position.
+func (s *Store) List(t playlist.Track) []Bookmark {
+	return s.marks[s.key(t)]
+}
+
+// key returns the key of a track's bookmarks. Provider tracks used to be
+// keyed by their bare ID; such bookmarks are moved to the track's key when
+// the track is first looked up, and written with the next change.
+func (s *Store) key(t playlist.Track) string {
+	key := t.Key()
+	if t.ID == "" || key == t.ID {
+		return key
+	}
+	if old, ok := s.marks[t.ID]; ok {
+		s.marks[key] = append(s.marks[key], old...)
+		slices.SortStableFunc(s.marks[key], func(x, y Bookmark) int {
+			return cmp.Compare(x.Position, y.Position)
+		})
+		delete(s.marks, t.ID)
+	}
+	return key
+}
+
+// Add saves a new bookmark for a track and writes the store to disk.
+func (s *Store) Add(t playlist.Track, b Bookmark) error {
+	key := s.key(t)
+	marks := append(s.marks[key], b)
+	slices.SortStableFunc(marks, func(x, y Bookmark) int {
+		return cmp.Compare(x.Position, y.Position)
+	})
+	s.marks[key] = marks
+	return s.save()
+}
+
+// Remove deletes the i-th bookmark of a track and writes the store to disk.
+func (s *Store) Remove(t playlist.Track, i int) error {
+	key := s.key(t)
+	marks := s.marks[key]
+	if i < 0 || i >= len(marks) {
+		return nil
+	}
+	marks = slices.Delete(marks, i, i+1)
+	if len(marks) == 0 {
+		delete(s.marks, key)
+	} else {
+		s.marks[key] = marks
+	}
+	return s.save()
+}
+
+func (s *Store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.marks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
@@ -0,0 +1,126 @@
+package bookmark
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"cliamp/playlist"
+)
+
+// dataDir points the bookmark file at a temporary directory and writes
+// marks to it, if set.
+func dataDir(t *testing.T, marks map[string][]Bookmark) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+	path := filepath.Join(dir, "cliamp", "bookmarks.json")
+	if marks != nil {
+		data, _ := json.Marshal(marks)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func mark(name string, sec int) Bookmark {
+	return Bookmark{Name: name, Position: time.Duration(sec) * time.Second}
+}
+
+func TestMigratesBareIDKeys(t *testing.T) {
+	nd := playlist.Track{ID: "42", Provider: "Navidrome", Path: "https://nd.example/rest/stream?id=42"}
+	local := playlist.Track{Path: "/music/a.mp3"}
+
+	tests := []struct {
+		name  string
+		marks map[string][]Bookmark
+		track playlist.Track
+		want  []Bookmark
+		left  []string // keys still in the store
+	}{
+		{
+			name:  "bare id",
+			marks: map[string][]Bookmark{"42": {mark("intro", 10)}},
+			track: nd,
+			want:  []Bookmark{mark("intro", 10)},
+			left:  []string{"Navidrome:42"},
+		},
+		{
+			name: "merged with new key",
+			marks: map[string][]Bookmark{
+				"42":           {mark("solo", 120)},
+				"Navidrome:42": {mark("intro", 10), mark("outro", 200)},
+			},
+			track: nd,
+			want:  []Bookmark{mark("intro", 10), mark("solo", 120), mark("outro", 200)},
+			left:  []string{"Navidrome:42"},
+		},
+		{
+			name:  "other provider",
+			marks: map[string][]Bookmark{"Jellyfin:42": {mark("intro", 10)}},
+			track: nd,
+			left:  []string{"Jellyfin:42"},
+		},
+		{
+			name:  "local file",
+			marks: map[string][]Bookmark{"/music/a.mp3": {mark("chorus", 45)}},
+			track: local,
+			want:  []Bookmark{mark("chorus", 45)},
+			left:  []string{"/music/a.mp3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir(t, tt.marks)
+			s, err := Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.List(tt.track); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List = %v, want %v", got, tt.want)
+			}
+			var left []string
+			for k := range s.marks {
+				left = append(left, k)
+			}
+			if !reflect.DeepEqual(left, tt.left) {
+				t.Errorf("keys = %q, want %q", left, tt.left)
+			}
+		})
+	}
+}
+
+func TestAddRemoveSaves(t *testing.T) {
+	path := dataDir(t, map[string][]Bookmark{"42": {mark("old", 30)}})
+	track := playlist.Track{ID: "42", Provider: "Navidrome"}
+
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(track, mark("new", 5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(track, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string][]Bookmark
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]Bookmark{"Navidrome:42": {mark("new", 5)}}
+	if !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved %v, want %v", saved, want)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"cliamp/player"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3";
+// otherwise the module version from the build info is used.
+var version string
+
+// Exit statuses, shared by all commands.
+const (
+	exitOK    = 0
+	exitError = 1 // the command failed
+	exitUsage = 2 // invalid command line
+)
+
+const usage = `usage: cliamp [play] [flags] [file|folder|URL ...]
+       cliamp scan <file|folder|URL> ...
+       cliamp ctl <command> [args]
+       cliamp attach
+       cliamp config check [--config FILE]
+       cliamp help [command]
+       cliamp --version
+
+Commands:
+  play     Play files, folders and stream URLs (the default)
+  scan     List the playable files found in files and folders
+  ctl      Send a command to a running instance
+  attach   Open a TUI on a running instance, such as a daemon
+  config   Check the config file
+  help     Show help for a command
+
+Run "cliamp help <command>" for the flags and details of a command.
+Exit status is 0 on success, 1 if the command failed and 2 on invalid usage.`
+
+const playUsage = `usage: cliamp [play] [flags] [file|folder|URL ...]
+
+Play files, folders and stream URLs in the TUI, or without a terminal with
+--no-tui; control such a daemon with "cliamp ctl" or open a TUI on it with
+"cliamp attach". Flags may be given before or after the files; use "--" to
+play a file named like a command.
+
+The playlist, queue and position are saved on exit and restored when cliamp
+is started without files; --resume restores them and adds the given files.
+
+Settings are read from $XDG_CONFIG_HOME/cliamp/config.toml (by default
+~/.config/cliamp/config.toml), or the file given with --config. The volume,
+shuffle, repeat and EQ preset flags override it for this run only.
+
+Configure Navidrome, Jellyfin and Plex servers in [[provider]] sections of
+the config file; all configured providers can be browsed.
+Environment variables override the first provider of each type:
+ - Navidrome: NAVIDROME_URL, NAVIDROME_USER, NAVIDROME_PASS, NAVIDROME_API_KEY,
+   NAVIDROME_LEGACY_AUTH, NAVIDROME_FORMAT, NAVIDROME_MAX_BITRATE
+ - Jellyfin: JELLYFIN_URL, JELLYFIN_USER, JELLYFIN_PASS, JELLYFIN_API_KEY,
+   JELLYFIN_MAX_BITRATE
+ - Plex: PLEX_URL, PLEX_TOKEN`
+
+const scanUsage = `usage: cliamp scan <file|folder|URL> ...
+
+List the playable files among the arguments and in folders below them, one
+absolute path per line, in the order cliamp would play them. URLs are
+listed as given. The output can be piped to "xargs cliamp ctl add".`
+
+const attachUsage = `usage: cliamp attach
+
+Open a TUI on a running instance, such as one started with --no-tui. Press
+q to detach; the instance keeps playing.`
+
+const configUsage = `usage: cliamp config check [--config FILE]
+
+Check the config file: report syntax errors, values of the wrong type,
+unknown keys, unknown EQ presets and incomplete [[provider]] sections, and
+run the password commands and keyring lookups of the providers. Exits with
+status 1 if anything was reported. Servers are not contacted.`
+
+// usageError is an invalid command line. It is reported with a pointer to
+// the command's help and exit status 2.
+type usageError struct {
+	cmd string // command whose help to point to, "" for the overview
+	msg string
+}
+
+func (e usageError) Error() string {
+	help := "cliamp help"
+	if e.cmd != "" {
+		help += " " + e.cmd
+	}
+	return fmt.Sprintf("%s\nRun %q for usage.", e.msg, help)
+}
+
+// command is a subcommand's flags and help text.
+type command struct {
+	name   string
+	usage  string
+	flags  *flag.FlagSet
+	hidden map[string]bool // aliases left out of the help
+}
+
+func newCommand(name, usage string) *command {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard) // errors and help are printed by parse
+	return &command{name: name, usage: usage, flags: fs, hidden: make(map[string]bool)}
+}
+
+// printHelp writes the command's help text and flags.
+func (c *command) printHelp(w io.Writer) {
+	fmt.Fprintln(w, c.usage)
+	var flags strings.Builder
+	c.flags.VisitAll(func(f *flag.Flag) {
+		if c.hidden[f.Name] {
+			return
+		}
+		arg, text := flag.UnquoteUsage(f)
+		name := "--" + f.Name
+		if arg != "" {
+			name += " " + arg
+		}
+		fmt.Fprintf(&flags, "  %-20s %s\n", name, text)
+	})
+	if flags.Len() > 0 {
+		fmt.Fprintf(w, "\nFlags:\n%s", flags.String())
+	}
+}
+
+// parse parses flags anywhere among args and returns the other arguments;
+// everything after "--" is taken literally. It prints the help and returns
+// flag.ErrHelp for -h and --help, and returns a usageError for invalid
+// flags.
+func (c *command) parse(args []string) ([]string, error) {
+	var rest []string
+	for {
+		err := c.flags.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			c.printHelp(os.Stdout)
+			return nil, err
+		}
+		if err != nil {
+			// The flag package names flags with a single dash
+			return nil, usageError{c.name, flagDashes.Replace(err.Error())}
+		}
+		left := c.flags.Args()
+		if len(left) == 0 {
+			return rest, nil
+		}
+		// Parse stops at the first non-flag argument, or after "--"
+		if consumed := args[:len(args)-len(left)]; len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			return append(rest, left...), nil
+		}
+		rest = append(rest, left[0])
+		args = left[1:]
+	}
+}
+
+// flagDashes rewrites the flag names in the flag package's errors, as in
+// "flag provided but not defined: -x" and "invalid value ... for flag -x".
+var flagDashes = strings.NewReplacer(": -", ": --", "for flag -", "for flag --")
+
+// set returns the names of the flags given on the command line.
+func (c *command) set() map[string]bool {
+	set := make(map[string]bool)
+	c.flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// isHelp reports whether args ask for a command's help.
+func isHelp(args []string) bool {
+	return len(args) > 0 && (args[0] == "-h" || args[0] == "--help" || args[0] == "help")
+}
+
+// versionString returns the program's version.
+func versionString() string {
+	v := version
+	if v == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			v = info.Main.Version
+		}
+	}
+	if v == "" {
+		v = "(devel)"
+	}
+	return "cliamp " + v
+}
+
+// runHelp implements `cliamp help [command]`.
+func runHelp(args []string) error {
+	if len(args) == 0 {
+		fmt.Println(usage)
+		return nil
+	}
+	switch args[0] {
+	case "play":
+		playCommand().printHelp(os.Stdout)
+	case "scan":
+		fmt.Println(scanUsage)
+	case "ctl":
+		fmt.Println(ctlUsage)
+	case "attach":
+		fmt.Println(attachUsage)
+	case "config":
+		configCommand().printHelp(os.Stdout)
+	default:
+		return usageError{"", fmt.Sprintf("unknown command %q", args[0])}
+	}
+	return nil
+}
+
+// runScan implements `cliamp scan`, listing the files play would load.
+func runScan(args []string) error {
+	if isHelp(args) {
+		fmt.Println(scanUsage)
+		return nil
+	}
+	if len(args) == 0 {
+		return usageError{"scan", "scan needs files or folders"}
+	}
+	paths, err := resolvePaths(args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return errors.New("no playable files found")
+	}
+	for _, p := range paths {
+		fmt.Println(p)
+	}
+	return nil
+}
+
+// configCommand returns the config command with its flags.
+func configCommand() *command {
+	c := newCommand("config", configUsage)
+	c.flags.String("config", "", "check `FILE` instead of the default config file")
+	return c
+}
+
+// runConfig implements `cliamp config check`.
+func runConfig(args []string) error {
+	c := configCommand()
+	if isHelp(args) {
+		c.printHelp(os.Stdout)
+		return nil
+	}
+	if len(args) == 0 || args[0] != "check" {
+		return usageError{"config", "config needs a subcommand: check"}
+	}
+	rest, err := c.parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usageError{"config", fmt.Sprintf("unexpected argument %q", rest[0])}
+	}
+
+	cfg, path, warnings, err := loadConfig(c.flags.Lookup("config").Value.String())
+	if err != nil {
+		return err
+	}
+	if _, err := eqPresetName(cfg.EQPreset); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	problems := len(warnings)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "config: warning: %s\n", w)
+	}
+	providers, err := buildProviders(cfg.Providers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		problems++
+	}
+	if problems > 0 {
+		return fmt.Errorf("config: %d problem(s) found", problems)
+	}
+	fmt.Printf("%s: OK, %d provider(s)\n", path, len(providers))
+	return nil
+}
+
+// eqPresetName returns the built-in EQ preset matching name regardless of
+// case. "" and "Custom" select the manual bands and are returned as is.
+func eqPresetName(name string) (string, error) {
+	if name == "" || strings.EqualFold(name, "Custom") {
+		return name, nil
+	}
+	names := player.EQPresetNames()
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return n, nil
+		}
+	}
+	return "", fmt.Errorf("unknown EQ preset %q (want one of %s)", name, strings.Join(names, ", "))
+}
+
+// parsePosition parses a playback position given as seconds ("90"), a
+// clock time ("1:30", "1:02:03") or a Go duration ("1m30s").
+func parsePosition(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	var total float64
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid position %q", s)
+	}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || v < 0 || i > 0 && v >= 60 {
+			return 0, fmt.Errorf("invalid position %q (want seconds, MM:SS or a duration like 1m30s)", s)
+		}
+		total = total*60 + v
+	}
+	// Beyond about 292 years the position no longer fits a time.Duration
+	if total*float64(time.Second) >= math.MaxInt64 {
+		return 0, fmt.Errorf("position %q is too large", s)
+	}
+	return time.Duration(total * float64(time.Second)), nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "90", want: 90 * time.Second},
+		{in: "2.5", want: 2500 * time.Millisecond},
+		{in: "1:30", want: 90 * time.Second},
+		{in: "01:02:03", want: time.Hour + 2*time.Minute + 3*time.Second},
+		{in: "90:00", want: 90 * time.Minute},
+		{in: "1m30s", want: 90 * time.Second},
+		{in: "1h", want: time.Hour},
+		{in: "", wantErr: true},
+		{in: "-5", wantErr: true},
+		{in: "-1m", wantErr: true},
+		{in: "1:60", wantErr: true},
+		{in: "1:2:3:4", wantErr: true},
+		{in: "1:xx", wantErr: true},
+		{in: "soon", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "nan:00", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "+Inf", wantErr: true},
+		{in: "1:inf", wantErr: true},
+		{in: "1e300", wantErr: true},
+		{in: "1e400", wantErr: true},
+		{in: "9999999999999:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePosition(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePosition(%q) err = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parsePosition(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCommandParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantRest []string
+		wantSet  map[string]bool
+		want     playFlags
+		wantErr  string
+	}{
+		{
+			name:     "no flags",
+			args:     []string{"a.mp3", "b.mp3"},
+			wantRest: []string{"a.mp3", "b.mp3"},
+			wantSet:  map[string]bool{},
+		},
+		{
+			name:     "flags before and after files",
+			args:     []string{"--volume", "-6", "a.mp3", "--shuffle", "b.mp3", "--repeat=one"},
+			wantRest: []string{"a.mp3", "b.mp3"},
+			wantSet:  map[string]bool{"volume": true, "shuffle": true, "repeat": true},
+			want:     playFlags{volume: -6, shuffle: true, repeat: "one"},
+		},
+		{
+			name:     "single dash",
+			args:     []string{"-no-tui", "dir"},
+			wantRest: []string{"dir"},
+			wantSet:  map[string]bool{"no-tui": true},
+			want:     playFlags{noTUI: true},
+		},
+		{
+			name:    "alias",
+			args:    []string{"--daemon"},
+			wantSet: map[string]bool{"daemon": true},
+			want:    playFlags{noTUI: true},
+		},
+		{
+			name:     "after double dash",
+			args:     []string{"--resume", "--", "--shuffle", "scan"},
+			wantRest: []string{"--shuffle", "scan"},
+			wantSet:  map[string]bool{"resume": true},
+			want:     playFlags{resume: true},
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"a.mp3", "--loud"},
+			wantErr: "flag provided but not defined: --loud\nRun \"cliamp help play\" for usage.",
+		},
+		{
+			name:    "missing value",
+			args:    []string{"a.mp3", "--repeat"},
+			wantErr: "flag needs an argument: --repeat\nRun \"cliamp help play\" for usage.",
+		},
+		{
+			name:    "invalid value",
+			args:    []string{"--volume", "max"},
+			wantErr: `invalid value "max" for flag --volume: parse error` + "\nRun \"cliamp help play\" for usage.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, f := newPlayCommand()
+			rest, err := c.parse(tt.args)
+			if tt.wantErr != "" {
+				var uerr usageError
+				if !errors.As(err, &uerr) || err.Error() != tt.wantErr {
+					t.Errorf("err = %v, want usage error %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("rest = %q, want %q", rest, tt.wantRest)
+			}
+			if set := c.set(); !reflect.DeepEqual(set, tt.wantSet) {
+				t.Errorf("set = %v, want %v", set, tt.wantSet)
+			}
+			if *f != tt.want {
+				t.Errorf("flags = %+v, want %+v", *f, tt.want)
+			}
+		})
+	}
+}
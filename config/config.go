@@ -1,155 +1,165 @@
-// Package config handles loading user configuration from ~/.config/cliamp/config.toml.
+// Package config handles loading user configuration from
+// $XDG_CONFIG_HOME/cliamp/config.toml and locates the other directories
+// cliamp keeps files in.
 package config
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
-)
 
-// configPath returns the path to the config file.
-func configPath() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(home, ".config", "cliamp", "config.toml"), nil
-}
+	"github.com/BurntSushi/toml"
+)
 
 // Config holds user preferences loaded from the config file.
 type Config struct {
-	Volume   float64     // dB, range [-30, +6]
-	EQ       [10]float64 // per-band gain in dB, range [-12, +12]
-	EQPreset string      // preset name, or "" for custom
-	Repeat   string      // "off", "all", or "one"
-	Shuffle  bool
+	Volume    float64     `toml:"volume"`    // dB, range [-30, +6]
+	EQ        [10]float64 `toml:"eq"`        // per-band gain in dB, range [-12, +12]
+	EQPreset  string      `toml:"eq_preset"` // preset name, or "" for custom
+	Repeat    RepeatMode  `toml:"repeat"`
+	Shuffle   bool        `toml:"shuffle"`
+	FadeMs    int         `toml:"fade_ms"`    // pause/stop/seek fade length in milliseconds, 0 disables
+	HTTPAddr  string      `toml:"http_addr"`  // listen address for the HTTP remote, "" disables
+	HTTPToken string      `toml:"http_token"` // bearer token required by the HTTP remote, "" for none
+	MPDAddr   string      `toml:"mpd_addr"`   // listen address for the MPD protocol server, "" disables
+
+	// Scrobbling; a service is enabled when its credentials are set
+	ListenBrainzToken string `toml:"listenbrainz_token"`
+	ListenBrainzURL   string `toml:"listenbrainz_url"` // API root, "" for the public server
+	LastFMAPIKey      string `toml:"lastfm_api_key"`
+	LastFMSecret      string `toml:"lastfm_secret"`
+	LastFMSessionKey  string `toml:"lastfm_session_key"` // used instead of user/password when set
+	LastFMUser        string `toml:"lastfm_user"`
+	LastFMPassword    string `toml:"lastfm_password"`
+	LastFMURL         string `toml:"lastfm_url"` // API endpoint, "" for last.fm
+
+	// Media servers from [[provider]] sections and environment variables
+	Providers []ProviderConfig `toml:"provider"`
+}
+
+// RepeatMode is the repeat setting: "off", "all" or "one".
+type RepeatMode string
+
+// UnmarshalText implements encoding.TextUnmarshaler, rejecting unknown
+// modes so that the decoder reports them with their line number.
+func (r *RepeatMode) UnmarshalText(text []byte) error {
+	switch mode := RepeatMode(strings.ToLower(string(text))); mode {
+	case "off", "all", "one":
+		*r = mode
+		return nil
+	}
+	return fmt.Errorf("invalid repeat mode %q (want \"off\", \"all\" or \"one\")", text)
 }
 
 // Default returns a Config with sensible defaults.
 func Default() Config {
 	return Config{
 		Repeat: "off",
+		FadeMs: 20,
 	}
 }
 
-// Load reads the config file from ~/.config/cliamp/config.toml.
-// Returns defaults if the file does not exist.
-func Load() (Config, error) {
+// Load reads the config file at path, usually Path(), and applies provider
+// overrides from the environment. Returns defaults if the file does not
+// exist. Invalid TOML and values of the wrong type are errors naming the
+// offending line; unknown keys are returned as warnings.
+func Load(path string) (Config, []string, error) {
 	cfg := Default()
-
-	path, err := configPath()
+	warnings, err := loadFile(path, &cfg)
 	if err != nil {
-		return cfg, nil
+		return cfg, warnings, err
 	}
+	return cfg, warnings, applyEnv(&cfg)
+}
 
-	f, err := os.Open(path)
+func loadFile(path string, cfg *Config) ([]string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			return cfg, nil
-		}
-		return cfg, err
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		key, val, ok := strings.Cut(line, "=")
-		if !ok {
-			continue
-		}
-		key = strings.TrimSpace(key)
-		val = strings.TrimSpace(val)
-
-		switch key {
-		case "volume":
-			if v, err := strconv.ParseFloat(val, 64); err == nil {
-				cfg.Volume = max(min(v, 6), -30)
-			}
-		case "repeat":
-			val = strings.Trim(val, `"'`)
-			switch strings.ToLower(val) {
-			case "all", "one", "off":
-				cfg.Repeat = strings.ToLower(val)
-			}
-		case "shuffle":
-			cfg.Shuffle = val == "true"
-		case "eq":
-			cfg.EQ = parseEQ(val)
-		case "eq_preset":
-			cfg.EQPreset = strings.Trim(val, `"'`)
+			return nil, nil
 		}
+		return nil, err
 	}
 
-	return cfg, scanner.Err()
-}
-
-// Save writes the config to ~/.config/cliamp/config.toml.
-func Save(cfg Config) error {
-	path, err := configPath()
+	md, err := toml.Decode(string(data), cfg)
 	if err != nil {
-		return err
+		// The decoder's messages start with "toml: line N (last key ...)"
+		return nil, fmt.Errorf("%s: %s", path, strings.TrimPrefix(err.Error(), "toml: "))
 	}
-
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return err
+	var warnings []string
+	for _, u := range unknownKeys(data, md) {
+		warnings = append(warnings, fmt.Sprintf("%s: %s", path, u))
 	}
 
-	eqParts := make([]string, 10)
+	cfg.Volume = max(min(cfg.Volume, 6), -30)
 	for i, v := range cfg.EQ {
-		eqParts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		cfg.EQ[i] = max(min(v, 12), -12)
 	}
+	cfg.FadeMs = max(min(cfg.FadeMs, 1000), 0)
+	for i := range cfg.Providers {
+		cfg.Providers[i].normalize()
+	}
+	return warnings, nil
+}
 
-	content := fmt.Sprintf(`# CLIAMP configuration
-
-# Default volume in dB (range: -30 to 6)
-volume = %s
-
-# Repeat mode: "off", "all", or "one"
-repeat = "%s"
-
-# Start with shuffle enabled
-shuffle = %t
-
-# EQ preset name (e.g. "Rock", "Jazz", "Classical", "Bass Boost")
-# Leave empty or "Custom" to use the manual eq values below
-eq_preset = "%s"
-
-# 10-band EQ gains in dB (range: -12 to 12)
-# Bands: 70Hz, 180Hz, 320Hz, 600Hz, 1kHz, 3kHz, 6kHz, 12kHz, 14kHz, 16kHz
-# Only used when eq_preset is "Custom" or empty
-eq = [%s]
-`,
-		strconv.FormatFloat(cfg.Volume, 'f', -1, 64),
-		cfg.Repeat,
-		cfg.Shuffle,
-		cfg.EQPreset,
-		strings.Join(eqParts, ", "),
-	)
+// unknownKeys describes the keys in data that are not part of the schema,
+// with the line each was found on. Keys inside an unknown table are
+// reported through the table.
+func unknownKeys(data []byte, md toml.MetaData) []string {
+	lines := keyLines(data)
+	used := make(map[int]bool)
+	var unknown []string
+	reported := make(map[string]bool)
+	for _, key := range md.Undecoded() {
+		if len(key) > 1 && reported[key[:len(key)-1].String()] {
+			continue
+		}
+		name := key.String()
+		reported[name] = true
 
-	return os.WriteFile(path, []byte(content), 0o644)
+		kind := "key"
+		if t := md.Type(key...); t == "Hash" || t == "ArrayHash" {
+			kind = "table"
+		}
+		msg := fmt.Sprintf("unknown %s %q", kind, name)
+		for _, n := range lines[name] {
+			if !used[n] {
+				used[n] = true
+				msg = fmt.Sprintf("line %d: %s", n, msg)
+				break
+			}
+		}
+		unknown = append(unknown, msg)
+	}
+	return unknown
 }
 
-// parseEQ parses a TOML-style array like [0, 1.5, -2, ...] into 10 bands.
-func parseEQ(val string) [10]float64 {
-	var bands [10]float64
-	val = strings.Trim(val, "[]")
-	parts := strings.Split(val, ",")
-	for i, p := range parts {
-		if i >= 10 {
-			break
-		}
-		if v, err := strconv.ParseFloat(strings.TrimSpace(p), 64); err == nil {
-			bands[i] = max(min(v, 12), -12)
+// keyLines maps dotted key paths to the lines defining them, in file
+// order, by tracking table headers and "key =" lines. It is only used to
+// point warnings at a line, so values spanning lines are not parsed.
+func keyLines(data []byte) map[string][]int {
+	lines := make(map[string][]int)
+	table := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "["):
+			name, _, _ := strings.Cut(strings.Trim(line, "[ "), "]")
+			table = strings.TrimSpace(name)
+			lines[table] = append(lines[table], i+1)
+		case line != "" && !strings.HasPrefix(line, "#"):
+			key, _, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			key = strings.Trim(strings.TrimSpace(key), `"'`)
+			if table != "" {
+				key = table + "." + key
+			}
+			lines[key] = append(lines[key], i+1)
 		}
 	}
-	return bands
+	return lines
 }
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets the provider overrides for the test.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, o := range envOverrides {
+		for _, name := range []string{"URL", "USER", "PASS", "API_KEY", "TOKEN", "FORMAT", "MAX_BITRATE", "LEGACY_AUTH"} {
+			t.Setenv(o.prefix+name, "")
+		}
+	}
+}
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "known keys",
+			data: "volume = -6\nrepeat = \"all\"\n\n[[provider]]\ntype = \"navidrome\"\nurl = \"http://nd\"\n",
+		},
+		{
+			name: "unknown key",
+			data: "volume = -6\nvolum = 3\n",
+			want: []string{`line 2: unknown key "volum"`},
+		},
+		{
+			name: "unknown provider key",
+			data: "[[provider]]\ntype = \"jellyfin\"\nurl = \"http://jf\"\npasword = \"x\"\n",
+			want: []string{`line 4: unknown key "provider.pasword"`},
+		},
+		{
+			name: "unknown table",
+			data: "shuffle = true\n\n[colors]\nfg = \"red\"\nbg = \"black\"\n",
+			want: []string{`line 3: unknown table "colors"`},
+		},
+		{
+			name: "repeated unknown key",
+			data: "[[provider]]\ntype = \"plex\"\nurl = \"http://a\"\nfoo = 1\n\n[[provider]]\ntype = \"plex\"\nurl = \"http://b\"\nfoo = 2\n",
+			want: []string{`line 4: unknown key "provider.foo"`, `line 9: unknown key "provider.foo"`},
+		},
+		{
+			name: "unreleased plex keys",
+			data: "plex_url = \"http://plex\"\nplex_token = \"t\"\n",
+			want: []string{`line 1: unknown key "plex_url"`, `line 2: unknown key "plex_token"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			path := writeConfig(t, tt.data)
+			_, warnings, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, w := range tt.want {
+				want = append(want, path+": "+w)
+			}
+			if !reflect.DeepEqual(warnings, want) {
+				t.Errorf("warnings = %q\nwant %q", warnings, want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"syntax", "volume = \n", "line 1"},
+		{"wrong type", "shuffle = true\nvolume = \"loud\"\n", "line 2"},
+		{"invalid repeat", "repeat = \"sometimes\"\n", `invalid repeat mode "sometimes"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			path := writeConfig(t, tt.data)
+			_, _, err := Load(path)
+			if err == nil || !strings.HasPrefix(err.Error(), path+": ") || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q about %s", err, path, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadValues(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("NAVIDROME_URL", "http://env/")
+	t.Setenv("NAVIDROME_MAX_BITRATE", "192")
+	path := writeConfig(t, `
+volume = 20
+eq = [15, -15, 0, 0, 0, 0, 0, 0, 0, 0]
+repeat = "ONE"
+fade_ms = 5000
+
+[[provider]]
+type = "Navidrome"
+url = "http://nd/"
+format = "OPUS"
+
+[[provider]]
+type = "plex"
+url = "http://plex"
+token = "t"
+`)
+	cfg, _, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Volume != 6 || cfg.EQ[0] != 12 || cfg.EQ[1] != -12 || cfg.FadeMs != 1000 {
+		t.Errorf("values not clamped: volume %v, eq %v, fade_ms %v", cfg.Volume, cfg.EQ[:2], cfg.FadeMs)
+	}
+	if cfg.Repeat != "one" {
+		t.Errorf("repeat = %q, want one", cfg.Repeat)
+	}
+	want := []ProviderConfig{
+		{Type: ProviderNavidrome, URL: "http://env", Format: "opus", MaxBitRate: 192},
+		{Type: ProviderPlex, URL: "http://plex", Token: "t"},
+	}
+	if !reflect.DeepEqual(cfg.Providers, want) {
+		t.Errorf("providers = %+v\nwant %+v", cfg.Providers, want)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	clearEnv(t)
+	cfg, warnings, err := Load(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil || warnings != nil {
+		t.Fatalf("Load = %v, %v", warnings, err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("cfg = %+v, want the defaults", cfg)
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// xdgDir returns $env/cliamp, or ~/fallback/cliamp if the variable is unset
+// or, as the XDG Base Directory spec requires, not an absolute path.
+func xdgDir(env string, fallback ...string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "cliamp"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append(append([]string{home}, fallback...), "cliamp")...), nil
+}
+
+// Dir returns the configuration directory: $XDG_CONFIG_HOME/cliamp, or
+// ~/.config/cliamp.
+func Dir() (string, error) {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// DataDir returns the directory for user data such as bookmarks:
+// $XDG_DATA_HOME/cliamp, or ~/.local/share/cliamp.
+func DataDir() (string, error) {
+	return xdgDir("XDG_DATA_HOME", ".local", "share")
+}
+
+// StateDir returns the directory for state kept between runs, such as the
+// last session: $XDG_STATE_HOME/cliamp, or ~/.local/state/cliamp.
+func StateDir() (string, error) {
+	return xdgDir("XDG_STATE_HOME", ".local", "state")
+}
+
+// Path returns the default config file, config.toml in Dir.
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// File returns the path of name in dir, which is one of the directory
+// functions above. Older versions kept all files in ~/.config/cliamp; a
+// file still found there is moved over first, or keeps being used if it
+// cannot be moved, e.g. to another file system.
+func File(dir func() (string, error), name string) (string, error) {
+	d, err := dir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(d, name)
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path, nil
+	}
+	legacy := filepath.Join(home, ".config", "cliamp", name)
+	if legacy == path {
+		return path, nil
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return path, nil
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(d, 0o700); err != nil {
+		return legacy, nil
+	}
+	if err := os.Rename(legacy, path); err != nil {
+		return legacy, nil
+	}
+	return path, nil
+}
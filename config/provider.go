@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"cliamp/keyring"
+)
+
+// Provider types.
+const (
+	ProviderNavidrome = "navidrome"
+	ProviderJellyfin  = "jellyfin"
+	ProviderPlex      = "plex"
+)
+
+// ProviderConfig configures one media server, from a [[provider]] section
+// of the config file or from environment variables.
+type ProviderConfig struct {
+	Type            string `toml:"type"`           // "navidrome", "jellyfin" or "plex"
+	Name            string `toml:"name,omitempty"` // shown in the source selector, "" for the type's name
+	URL             string `toml:"url"`
+	User            string `toml:"user,omitempty"`
+	Password        string `toml:"password,omitempty"`
+	PasswordCommand string `toml:"password_command,omitempty"` // shell command printing the password, e.g. "pass show navidrome"
+	Keyring         bool   `toml:"keyring,omitempty"`          // read the password from the system keyring
+	APIKey          string `toml:"api_key,omitempty"`          // Navidrome and Jellyfin, used instead of a password
+	Token           string `toml:"token,omitempty"`            // Plex
+	Format          string `toml:"format,omitempty"`           // Navidrome stream format
+	MaxBitRate      int    `toml:"max_bitrate,omitzero"`       // kbps, 0 for the server default
+	LegacyAuth      bool   `toml:"legacy_auth,omitempty"`      // Navidrome
+}
+
+// DisplayName returns the provider's name, defaulting to its type.
+func (p ProviderConfig) DisplayName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	switch p.Type {
+	case ProviderNavidrome:
+		return "Navidrome"
+	case ProviderJellyfin:
+		return "Jellyfin"
+	case ProviderPlex:
+		return "Plex"
+	}
+	return p.Type
+}
+
+// normalize canonicalizes values read from the config file.
+func (p *ProviderConfig) normalize() {
+	p.Type = strings.ToLower(p.Type)
+	p.URL = strings.TrimRight(p.URL, "/")
+	p.Format = strings.ToLower(p.Format)
+	p.MaxBitRate = max(p.MaxBitRate, 0)
+}
+
+// Secret returns the provider's password (the token for Plex): the value
+// set in the config or environment, else the output of PasswordCommand,
+// else the system keyring entry. It returns "" if none is configured.
+func (p ProviderConfig) Secret() (string, error) {
+	if p.Type == ProviderPlex && p.Token != "" {
+		return p.Token, nil
+	}
+	if p.Password != "" {
+		return p.Password, nil
+	}
+	if p.PasswordCommand != "" {
+		return runPasswordCommand(p.PasswordCommand)
+	}
+	if p.Keyring {
+		secret, err := keyring.Lookup(p.KeyringAttributes())
+		if errors.Is(err, keyring.ErrNotFound) {
+			return "", fmt.Errorf("no keyring entry for %s (store one with: secret-tool store --label=%q service cliamp provider %q)",
+				p.DisplayName(), "cliamp "+p.DisplayName(), p.DisplayName())
+		}
+		return secret, err
+	}
+	return "", nil
+}
+
+// KeyringAttributes returns the attributes identifying the provider's
+// password in the system keyring.
+func (p ProviderConfig) KeyringAttributes() map[string]string {
+	return map[string]string{"service": "cliamp", "provider": p.DisplayName()}
+}
+
+// runPasswordCommand runs a password command through the shell and returns
+// the first line of its output, so that tools like pass, which print
+// metadata after the password, work unchanged.
+func runPasswordCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("password_command %q: %w: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("password_command %q: %w", command, err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimRight(line, "\r"), nil
+}
+
+// envOverrides lists, per provider type, the environment variables that
+// override provider settings.
+var envOverrides = []struct {
+	typ    string
+	prefix string
+}{
+	{ProviderNavidrome, "NAVIDROME_"},
+	{ProviderJellyfin, "JELLYFIN_"},
+	{ProviderPlex, "PLEX_"},
+}
+
+// applyEnv overrides the first provider of each type with its environment
+// variables (e.g. NAVIDROME_URL, NAVIDROME_USER, NAVIDROME_PASS), adding a
+// provider if none is configured and the URL variable is set.
+func applyEnv(cfg *Config) error {
+	for _, o := range envOverrides {
+		get := func(name string) string { return os.Getenv(o.prefix + name) }
+
+		i := -1
+		for j, p := range cfg.Providers {
+			if p.Type == o.typ {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			if get("URL") == "" {
+				continue
+			}
+			cfg.Providers = append(cfg.Providers, ProviderConfig{Type: o.typ})
+			i = len(cfg.Providers) - 1
+		}
+		p := &cfg.Providers[i]
+
+		if v := get("URL"); v != "" {
+			p.URL = strings.TrimRight(v, "/")
+		}
+		if v := get("USER"); v != "" {
+			p.User = v
+		}
+		if v := get("PASS"); v != "" {
+			p.Password = v
+		}
+		if v := get("API_KEY"); v != "" {
+			p.APIKey = v
+		}
+		if v := get("TOKEN"); v != "" {
+			p.Token = v
+		}
+		if v := get("FORMAT"); v != "" {
+			p.Format = strings.ToLower(v)
+		}
+		if v := get("MAX_BITRATE"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%sMAX_BITRATE: invalid bitrate %q", o.prefix, v)
+			}
+			p.MaxBitRate = n
+		}
+		if v := get("LEGACY_AUTH"); v != "" {
+			p.LegacyAuth, _ = strconv.ParseBool(v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Settings are the preferences that can be changed in the TUI and are
+// written back to the config file.
+type Settings struct {
+	Volume   float64     `toml:"volume"`
+	EQ       [10]float64 `toml:"eq"`
+	EQPreset string      `toml:"eq_preset"` // preset name, or "Custom"
+	Repeat   RepeatMode  `toml:"repeat"`
+	Shuffle  bool        `toml:"shuffle"`
+}
+
+// Settings returns the config's TUI-changeable settings.
+func (c Config) Settings() Settings {
+	return Settings{Volume: c.Volume, EQ: c.EQ, EQPreset: c.EQPreset, Repeat: c.Repeat, Shuffle: c.Shuffle}
+}
+
+// Save writes the settings that differ from the config file at path into
+// it, editing their values in place so that comments, formatting and all
+// other keys are kept. Missing keys are added before the first table. The
+// file is left untouched if nothing changed.
+func Save(path string, s Settings) error {
+	// Write through symlinks, as is common for dotfile managers
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	cur := Default().Settings()
+	if _, err := toml.Decode(string(data), &cur); err != nil {
+		return fmt.Errorf("%s: %s", path, strings.TrimPrefix(err.Error(), "toml: "))
+	}
+
+	var keys []string
+	values := make(map[string]any)
+	set := func(key string, v any) {
+		keys = append(keys, key)
+		values[key] = v
+	}
+	if s.Volume != cur.Volume {
+		set("volume", s.Volume)
+	}
+	if s.Repeat != cur.Repeat {
+		set("repeat", string(s.Repeat))
+	}
+	if s.Shuffle != cur.Shuffle {
+		set("shuffle", s.Shuffle)
+	}
+	custom := s.EQPreset == "" || strings.EqualFold(s.EQPreset, "Custom")
+	curCustom := cur.EQPreset == "" || strings.EqualFold(cur.EQPreset, "Custom")
+	if custom != curCustom || !custom && !strings.EqualFold(s.EQPreset, cur.EQPreset) {
+		set("eq_preset", s.EQPreset)
+	}
+	// The bands only apply without a preset; keep the custom ones otherwise
+	if custom && s.EQ != cur.EQ {
+		set("eq", s.EQ[:])
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if len(data) == 0 {
+		data = []byte("# CLIAMP configuration\n")
+	}
+	out, err := setKeys(string(data), keys, values)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, []byte(out))
+}
+
+// writeFile replaces path with data through a temporary file, so that an
+// interrupted write cannot truncate the config. The file's permissions
+// are kept; new files are private since they may hold passwords.
+func writeFile(path string, data []byte) error {
+	mode := fs.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".config.toml.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// setKeys sets the values of top-level keys in a TOML document, keeping
+// everything else byte for byte. Keys not present are added after the
+// last top-level key, or at the end of the top-level section if it has
+// none, so they stay out of tables.
+func setKeys(src string, keys []string, values map[string]any) (string, error) {
+	var b strings.Builder
+	done := make(map[string]bool)
+	pos := 0
+	last := -1 // end of the last top-level key's line in b
+	for pos < len(src) {
+		end := strings.IndexByte(src[pos:], '\n') + 1
+		if end == 0 {
+			end = len(src) - pos
+		}
+		line := src[pos : pos+end]
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			break // the first table ends the top-level section
+		}
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			b.WriteString(line)
+			pos += end
+			continue
+		}
+
+		name := strings.Trim(strings.TrimSpace(key), `"'`)
+		start := pos + len(key) + 1 + len(rest) - len(strings.TrimLeft(rest, " \t"))
+		stop := valueEnd(src, start)
+		if v, ok := values[name]; ok && !done[name] {
+			val, err := tomlValue(v)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(src[pos:start])
+			b.WriteString(val)
+			done[name] = true
+		} else {
+			b.WriteString(src[pos:stop])
+		}
+		pos = stop
+
+		// Copy the rest of the line, e.g. a comment
+		end = strings.IndexByte(src[pos:], '\n') + 1
+		if end == 0 {
+			end = len(src) - pos
+		}
+		b.WriteString(src[pos : pos+end])
+		pos += end
+		last = b.Len()
+	}
+	if last < 0 {
+		last = b.Len()
+	}
+
+	var missing strings.Builder
+	for _, key := range keys {
+		if done[key] {
+			continue
+		}
+		val, err := tomlValue(values[key])
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&missing, "%s = %s\n", key, val)
+	}
+	head := b.String()
+	if missing.Len() > 0 && last > 0 && head[last-1] != '\n' {
+		head = head[:last] + "\n" + head[last:]
+		last++
+	}
+	return head[:last] + missing.String() + head[last:] + src[pos:], nil
+}
+
+// valueEnd returns the offset just past the TOML value starting at i,
+// which may span lines for arrays, inline tables and multi-line strings.
+// Trailing whitespace and comments are not part of the value.
+func valueEnd(s string, i int) int {
+	depth := 0
+	for i < len(s) {
+		switch c := s[i]; c {
+		case '"', '\'':
+			i = stringEnd(s, i)
+			continue
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case '#':
+			if depth == 0 {
+				return trimEnd(s, i)
+			}
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			continue
+		case '\n':
+			if depth == 0 {
+				return trimEnd(s, i)
+			}
+		}
+		i++
+	}
+	return trimEnd(s, i)
+}
+
+// stringEnd returns the offset just past the string starting at i.
+func stringEnd(s string, i int) int {
+	q := s[i : i+1]
+	if strings.HasPrefix(s[i:], q+q+q) {
+		if j := strings.Index(s[i+3:], q+q+q); j >= 0 {
+			end := i + 3 + j + 3
+			// Up to two more quotes may belong to the content
+			for n := 0; n < 2 && end < len(s) && s[end] == q[0]; n++ {
+				end++
+			}
+			return end
+		}
+		return len(s)
+	}
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if q == `"` {
+				j++
+			}
+		case q[0], '\n':
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// trimEnd moves back from i over spaces and tabs.
+func trimEnd(s string, i int) int {
+	for i > 0 && (s[i-1] == ' ' || s[i-1] == '\t' || s[i-1] == '\r') {
+		i--
+	}
+	return i
+}
+
+// tomlValue encodes a single value as TOML.
+func tomlValue(v any) (string, error) {
+	b, err := toml.Marshal(map[string]any{"v": v})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(string(b), "v = ")), nil
+}
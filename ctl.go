@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"cliamp/ipc"
+)
+
+const ctlUsage = `usage: cliamp ctl <command> [args]
+
+Commands:
+  status               Show the current track and player state
+  play [N]             Start or resume playback, or play track N
+  pause                Pause playback
+  toggle               Toggle play/pause
+  stop                 Stop playback
+  next, prev           Skip to the next / previous track
+  seek [+|-]SECONDS    Seek relative (+/-) or to an absolute position
+  volume [+|-|=]DB     Change volume relative (+/-) or set it in dB (=-6)
+  add PATH...          Add files, folders or URLs to the end of the playlist
+  queue add PATH...    Add files, folders or URLs and queue them to play next
+  queue N...           Queue playlist tracks by number
+  dequeue N...         Remove playlist tracks from the queue
+  list                 List the playlist
+  eq preset NAME       Apply an EQ preset
+  eq BAND DB           Set one EQ band (1-10) in dB
+  repeat off|all|one   Set the repeat mode
+  shuffle on|off|toggle
+                       Set or toggle shuffle
+  sleep MIN|track|album|off
+                       Set or cancel the sleep timer
+  quit                 Quit the running instance (stops a daemon)`
+
+// runCtl implements the `cliamp ctl` subcommand, sending a single command to
+// a running instance over the control socket.
+func runCtl(args []string) error {
+	if isHelp(args) {
+		fmt.Println(ctlUsage)
+		return nil
+	}
+	if len(args) == 0 {
+		return usageError{"ctl", "ctl needs a command"}
+	}
+
+	req := ipc.Request{Cmd: args[0], Args: args[1:]}
+	if req.Cmd == "add" || (req.Cmd == "queue" && len(req.Args) > 0 && req.Args[0] == "add") {
+		if req.Cmd == "queue" {
+			req.Args = req.Args[1:]
+		}
+		paths, err := resolvePaths(req.Args)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return errors.New("no playable files found")
+		}
+		req.Args = paths
+	}
+
+	resp, err := ipc.Send(ipc.SocketPath(), req)
+	if err != nil {
+		return err
+	}
+	if req.Cmd == "status" && resp.Status != nil {
+		printStatus(*resp.Status)
+	}
+	if req.Cmd == "list" {
+		printPlaylist(resp)
+	}
+	return nil
+}
+
+// resolvePaths expands globs and folders into absolute audio file paths,
+// since the running instance may have a different working directory.
+func resolvePaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil || len(matches) == 0 {
+			matches = []string{arg}
+		}
+		for _, path := range matches {
+			files, err := collectAudioFiles(path)
+			if err != nil {
+				return nil, fmt.Errorf("scanning %s: %w", path, err)
+			}
+			for _, f := range files {
+				abs, err := filepath.Abs(f)
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, abs)
+			}
+		}
+	}
+	return paths, nil
+}
+
+func printStatus(s ipc.Status) {
+	name := s.Track.Title
+	if s.Track.Artist != "" {
+		name = s.Track.Artist + " - " + name
+	}
+	if s.Index < 0 {
+		name = "(none)"
+	}
+	fmt.Printf("%s: %s\n", s.State, name)
+	if s.Track.Album != "" {
+		fmt.Printf("album: %s\n", s.Track.Album)
+	}
+	fmt.Printf("time: %s / %s\n", formatSeconds(s.Position), formatSeconds(s.Duration))
+	fmt.Printf("track: %d/%d  queue: %d\n", s.Index+1, s.Tracks, s.Queue)
+	fmt.Printf("volume: %+.1fdB  repeat: %s  shuffle: %t\n", s.Volume, s.Repeat, s.Shuffle)
+	if s.Sleep != "" {
+		fmt.Printf("sleep: %s\n", s.Sleep)
+	}
+}
+
+func printPlaylist(resp ipc.Response) {
+	cur := -1
+	if resp.Status != nil && resp.Status.State != "stopped" {
+		cur = resp.Status.Index
+	}
+	for i, t := range resp.Playlist {
+		marker := " "
+		if i == cur {
+			marker = ">"
+		}
+		name := t.Title
+		if t.Artist != "" {
+			name = t.Artist + " - " + name
+		}
+		if t.Queued > 0 {
+			name += fmt.Sprintf(" [Q%d]", t.Queued)
+		}
+		fmt.Printf("%s %d. %s\n", marker, i+1, name)
+	}
+}
+
+func formatSeconds(sec float64) string {
+	total := int(sec)
+	return fmt.Sprintf("%02d:%02d", total/60, total%60)
+}
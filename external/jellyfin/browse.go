@@ -0,0 +1,252 @@
+package jellyfin
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"cliamp/playlist"
+)
+
+const (
+	// albumListSize is how many albums are fetched for album lists.
+	albumListSize = 200
+
+	// searchCount caps the number of artists, albums and songs a search
+	// returns in total.
+	searchCount = 60
+)
+
+// Browse IDs are prefixed with the kind of node they refer to, e.g.
+// "artist:ID" or "genre:ID".
+const (
+	browsePlaylists = "playlists"
+	browseArtists   = "artists"
+	browseGenres    = "genres"
+	browseFavorites = "favorites"
+	browseRecent    = "recent"
+	prefixPlaylist  = "playlist:"
+	prefixArtist    = "artist:"
+	prefixAlbum     = "album:"
+	prefixGenre     = "genre:"
+)
+
+// Browse implements playlist.Browser over the Jellyfin music library.
+func (c *JellyfinClient) Browse(id string) ([]playlist.Entry, error) {
+	switch {
+	case id == "":
+		// The root is the first request made, so sign in here and fail
+		// with a clear error instead of an empty library.
+		if _, _, err := c.session(); err != nil {
+			return nil, err
+		}
+		return []playlist.Entry{
+			{ID: browsePlaylists, Name: "Playlists"},
+			{ID: browseFavorites, Name: "Favorites"},
+			{ID: browseArtists, Name: "Artists"},
+			{ID: browseRecent, Name: "Recently Added"},
+			{ID: browseGenres, Name: "Genres"},
+		}, nil
+	case id == browsePlaylists:
+		return c.playlistEntries()
+	case id == browseArtists:
+		return c.Artists()
+	case id == browseGenres:
+		return c.Genres()
+	case id == browseFavorites:
+		return c.Favorites()
+	case id == browseRecent:
+		return c.albums(url.Values{
+			"SortBy":    {"DateCreated"},
+			"SortOrder": {"Descending"},
+			"Limit":     {strconv.Itoa(albumListSize)},
+		}, true)
+	case strings.HasPrefix(id, prefixPlaylist):
+		items, err := c.playlistItems(strings.TrimPrefix(id, prefixPlaylist))
+		if err != nil {
+			return nil, err
+		}
+		return c.songEntries(items), nil
+	case strings.HasPrefix(id, prefixArtist):
+		return c.albums(url.Values{
+			"AlbumArtistIds": {strings.TrimPrefix(id, prefixArtist)},
+			"SortBy":         {"ProductionYear,SortName"},
+		}, false)
+	case strings.HasPrefix(id, prefixAlbum):
+		return c.Album(strings.TrimPrefix(id, prefixAlbum))
+	case strings.HasPrefix(id, prefixGenre):
+		return c.albums(url.Values{
+			"GenreIds": {strings.TrimPrefix(id, prefixGenre)},
+			"SortBy":   {"AlbumArtist,SortName"},
+		}, true)
+	}
+	return nil, fmt.Errorf("unknown library entry %q", id)
+}
+
+func (c *JellyfinClient) playlistEntries() ([]playlist.Entry, error) {
+	lists, err := c.Playlists()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]playlist.Entry, len(lists))
+	for i, p := range lists {
+		entries[i] = playlist.Entry{
+			ID:   prefixPlaylist + p.ID,
+			Name: p.Name,
+			Info: plural(p.TrackCount, "track"),
+		}
+	}
+	return entries, nil
+}
+
+// Artists lists the album artists in the library.
+func (c *JellyfinClient) Artists() ([]playlist.Entry, error) {
+	_, userID, err := c.session()
+	if err != nil {
+		return nil, err
+	}
+	var result itemsResult
+	params := url.Values{"UserId": {userID}, "SortBy": {"SortName"}}
+	if err := c.get("/Artists/AlbumArtists", params, &result); err != nil {
+		return nil, err
+	}
+	entries := make([]playlist.Entry, len(result.Items))
+	for i, a := range result.Items {
+		entries[i] = playlist.Entry{ID: prefixArtist + a.ID, Name: a.Name}
+	}
+	return entries, nil
+}
+
+// Album lists the tracks of an album in disc and track order.
+func (c *JellyfinClient) Album(id string) ([]playlist.Entry, error) {
+	items, err := c.items(url.Values{
+		"ParentId":         {id},
+		"IncludeItemTypes": {"Audio"},
+		"SortBy":           {"ParentIndexNumber,IndexNumber,SortName"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.songEntries(items), nil
+}
+
+// Genres lists the music genres in the library.
+func (c *JellyfinClient) Genres() ([]playlist.Entry, error) {
+	_, userID, err := c.session()
+	if err != nil {
+		return nil, err
+	}
+	var result itemsResult
+	params := url.Values{"UserId": {userID}, "SortBy": {"SortName"}}
+	if err := c.get("/MusicGenres", params, &result); err != nil {
+		return nil, err
+	}
+	entries := make([]playlist.Entry, len(result.Items))
+	for i, g := range result.Items {
+		entries[i] = playlist.Entry{ID: prefixGenre + g.ID, Name: g.Name}
+	}
+	return entries, nil
+}
+
+// Favorites lists the tracks marked as favorites.
+func (c *JellyfinClient) Favorites() ([]playlist.Entry, error) {
+	items, err := c.items(url.Values{
+		"IncludeItemTypes": {"Audio"},
+		"Recursive":        {"true"},
+		"Filters":          {"IsFavorite"},
+		"SortBy":           {"AlbumArtist,Album,SortName"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.songEntries(items), nil
+}
+
+// albums lists albums matching params.
+func (c *JellyfinClient) albums(params url.Values, withArtist bool) ([]playlist.Entry, error) {
+	params.Set("IncludeItemTypes", "MusicAlbum")
+	params.Set("Recursive", "true")
+	items, err := c.items(params)
+	if err != nil {
+		return nil, err
+	}
+	return albumEntries(items, withArtist), nil
+}
+
+// albumEntries converts albums to entries, prefixing the artist name for
+// lists that mix artists.
+func albumEntries(albums []item, withArtist bool) []playlist.Entry {
+	entries := make([]playlist.Entry, len(albums))
+	for i, a := range albums {
+		name := a.Name
+		if withArtist && a.AlbumArtist != "" {
+			name = a.AlbumArtist + " - " + a.Name
+		}
+		info := plural(a.ChildCount, "track")
+		if a.ProductionYear > 0 {
+			info = strconv.Itoa(a.ProductionYear) + ", " + info
+		}
+		entries[i] = playlist.Entry{ID: prefixAlbum + a.ID, Name: name, Info: info}
+	}
+	return entries
+}
+
+func (c *JellyfinClient) songEntries(items []item) []playlist.Entry {
+	entries := make([]playlist.Entry, len(items))
+	for i, it := range items {
+		t := c.track(it)
+		secs := int(it.RunTimeTicks / ticksPerSecond)
+		entries[i] = playlist.Entry{
+			ID:    it.ID,
+			Name:  t.DisplayName(),
+			Info:  fmt.Sprintf("%d:%02d", secs/60, secs%60),
+			Track: &t,
+		}
+	}
+	return entries
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// Search implements playlist.Searcher, returning matching artists, then
+// albums, then songs.
+func (c *JellyfinClient) Search(query string) ([]playlist.Entry, error) {
+	items, err := c.items(url.Values{
+		"SearchTerm":       {query},
+		"IncludeItemTypes": {"MusicArtist,MusicAlbum,Audio"},
+		"Recursive":        {"true"},
+		"Limit":            {strconv.Itoa(searchCount)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var artists, albums, songs []item
+	for _, it := range items {
+		switch it.Type {
+		case "MusicArtist":
+			artists = append(artists, it)
+		case "MusicAlbum":
+			albums = append(albums, it)
+		case "Audio":
+			songs = append(songs, it)
+		}
+	}
+
+	var entries []playlist.Entry
+	for _, a := range artists {
+		entries = append(entries, playlist.Entry{ID: prefixArtist + a.ID, Name: a.Name, Info: "artist"})
+	}
+	for _, e := range albumEntries(albums, true) {
+		e.Info = "album, " + e.Info
+		entries = append(entries, e)
+	}
+	entries = append(entries, c.songEntries(songs)...)
+	return entries, nil
+}
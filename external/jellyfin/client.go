@@ -0,0 +1,347 @@
+// Package jellyfin implements a playlist provider for Jellyfin media servers.
+package jellyfin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cliamp/playlist"
+)
+
+const (
+	clientName    = "cliamp"
+	clientVersion = "1.0"
+
+	// ticksPerSecond converts Jellyfin run times, given in 100ns ticks.
+	ticksPerSecond = 10_000_000
+
+	// directContainers are the containers the player can decode, offered
+	// to the server so that it only transcodes what is not among them.
+	directContainers = "mp3,flac,ogg,oga,opus,wav,m4a,aac"
+)
+
+// httpClient is shared by all API requests. Streams are opened by the
+// player and are not subject to this timeout.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// JellyfinClient talks to a Jellyfin server. It authenticates with APIKey
+// if set, acting on behalf of User (or the first administrator if User is
+// empty); otherwise it signs in with User and Password.
+//
+// MaxBitRate caps the stream bitrate in kbps (0 for no limit).
+type JellyfinClient struct {
+	Label      string // display name, "" for "Jellyfin"
+	URL        string
+	User       string
+	Password   string
+	APIKey     string
+	MaxBitRate int
+
+	mu     sync.Mutex
+	token  string
+	userID string
+}
+
+func (c *JellyfinClient) Name() string {
+	if c.Label != "" {
+		return c.Label
+	}
+	return "Jellyfin"
+}
+
+// item is the subset of a Jellyfin BaseItemDto used by the client.
+type item struct {
+	ID             string   `json:"Id"`
+	Name           string   `json:"Name"`
+	Type           string   `json:"Type"`
+	Album          string   `json:"Album"`
+	AlbumArtist    string   `json:"AlbumArtist"`
+	Artists        []string `json:"Artists"`
+	RunTimeTicks   int64    `json:"RunTimeTicks"`
+	ChildCount     int      `json:"ChildCount"`
+	ProductionYear int      `json:"ProductionYear"`
+	UserData       struct {
+		IsFavorite bool `json:"IsFavorite"`
+	} `json:"UserData"`
+}
+
+type itemsResult struct {
+	Items []item `json:"Items"`
+}
+
+// authorization builds the MediaBrowser authorization header sent with
+// every request.
+func (c *JellyfinClient) authorization(token string) string {
+	h := fmt.Sprintf(`MediaBrowser Client="%s", Device="%s", DeviceId="%s", Version="%s"`,
+		clientName, deviceName(), deviceID(), clientVersion)
+	if token != "" {
+		h += fmt.Sprintf(`, Token="%s"`, token)
+	}
+	return h
+}
+
+func deviceName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return clientName
+	}
+	return host
+}
+
+// deviceID identifies this machine to the server, which keeps one session
+// per device.
+func deviceID() string {
+	return clientName + "-" + deviceName()
+}
+
+// session returns the access token and user ID, signing in first if
+// needed.
+func (c *JellyfinClient) session() (token, userID string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && c.userID != "" {
+		return c.token, c.userID, nil
+	}
+
+	if c.APIKey != "" {
+		userID, err := c.apiKeyUser()
+		if err != nil {
+			return "", "", err
+		}
+		c.token, c.userID = c.APIKey, userID
+		return c.token, c.userID, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"Username": c.User, "Pw": c.Password})
+	var result struct {
+		AccessToken string `json:"AccessToken"`
+		User        struct {
+			ID string `json:"Id"`
+		} `json:"User"`
+	}
+	if err := c.do(http.MethodPost, "/Users/AuthenticateByName", "", nil, body, &result); err != nil {
+		if isStatus(err, http.StatusUnauthorized) {
+			return "", "", errors.New("jellyfin: wrong username or password")
+		}
+		return "", "", err
+	}
+	c.token, c.userID = result.AccessToken, result.User.ID
+	return c.token, c.userID, nil
+}
+
+// apiKeyUser finds the user an API key acts for. API keys are not bound
+// to a user, so the user is looked up by name.
+func (c *JellyfinClient) apiKeyUser() (string, error) {
+	var users []struct {
+		ID     string `json:"Id"`
+		Name   string `json:"Name"`
+		Policy struct {
+			IsAdministrator bool `json:"IsAdministrator"`
+		} `json:"Policy"`
+	}
+	if err := c.do(http.MethodGet, "/Users", c.APIKey, nil, nil, &users); err != nil {
+		if isStatus(err, http.StatusUnauthorized) {
+			return "", errors.New("jellyfin: invalid API key")
+		}
+		return "", err
+	}
+	for _, u := range users {
+		if c.User != "" && strings.EqualFold(u.Name, c.User) || c.User == "" && u.Policy.IsAdministrator {
+			return u.ID, nil
+		}
+	}
+	if c.User != "" {
+		return "", fmt.Errorf("jellyfin: no user named %q", c.User)
+	}
+	return "", errors.New("jellyfin: no administrator found; set the user to act as")
+}
+
+// get calls an API endpoint as the signed-in user and decodes the JSON
+// response into out. An expired session is renewed once.
+func (c *JellyfinClient) get(path string, params url.Values, out any) error {
+	token, _, err := c.session()
+	if err != nil {
+		return err
+	}
+	err = c.do(http.MethodGet, path, token, params, nil, out)
+	if isStatus(err, http.StatusUnauthorized) && c.APIKey == "" {
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+		if token, _, err = c.session(); err != nil {
+			return err
+		}
+		err = c.do(http.MethodGet, path, token, params, nil, out)
+	}
+	return err
+}
+
+// statusError is returned when the server answers with a non-2xx status.
+type statusError struct {
+	path   string
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("jellyfin %s: %s", e.path, e.status)
+}
+
+func isStatus(err error, code int) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.code == code
+}
+
+// do performs a single request. body, if set, is sent as JSON.
+func (c *JellyfinClient) do(method, path, token string, params url.Values, body []byte, out any) error {
+	u := c.URL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.authorization(token))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("jellyfin %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{path: path, code: resp.StatusCode, status: resp.Status}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("jellyfin %s: invalid response: %w", path, err)
+	}
+	return nil
+}
+
+// items lists the signed-in user's library items matching params.
+func (c *JellyfinClient) items(params url.Values) ([]item, error) {
+	_, userID, err := c.session()
+	if err != nil {
+		return nil, err
+	}
+	if params.Get("Fields") == "" {
+		params.Set("Fields", "ChildCount")
+	}
+	var result itemsResult
+	if err := c.get("/Users/"+userID+"/Items", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+func (c *JellyfinClient) Playlists() ([]playlist.PlaylistInfo, error) {
+	items, err := c.items(url.Values{
+		"IncludeItemTypes": {"Playlist"},
+		"MediaTypes":       {"Audio"},
+		"Recursive":        {"true"},
+		"SortBy":           {"SortName"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var lists []playlist.PlaylistInfo
+	for _, it := range items {
+		lists = append(lists, playlist.PlaylistInfo{
+			ID:         it.ID,
+			Name:       it.Name,
+			TrackCount: it.ChildCount,
+		})
+	}
+	return lists, nil
+}
+
+func (c *JellyfinClient) Tracks(id string) ([]playlist.Track, error) {
+	items, err := c.playlistItems(id)
+	if err != nil {
+		return nil, err
+	}
+	var tracks []playlist.Track
+	for _, it := range items {
+		tracks = append(tracks, c.track(it))
+	}
+	return tracks, nil
+}
+
+func (c *JellyfinClient) playlistItems(id string) ([]item, error) {
+	_, userID, err := c.session()
+	if err != nil {
+		return nil, err
+	}
+	var result itemsResult
+	params := url.Values{"UserId": {userID}, "IncludeItemTypes": {"Audio"}}
+	if err := c.get("/Playlists/"+id+"/Items", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// track converts an audio item into a streamable playlist track.
+func (c *JellyfinClient) track(it item) playlist.Track {
+	artist := it.AlbumArtist
+	if len(it.Artists) > 0 {
+		artist = strings.Join(it.Artists, ", ")
+	}
+	return playlist.Track{
+		Path:     c.streamURL(it.ID, directContainers),
+		Fallback: c.streamURL(it.ID, "mp3"),
+		Title:    it.Name,
+		Artist:   artist,
+		Album:    it.Album,
+		ID:       it.ID,
+		Starred:  it.UserData.IsFavorite,
+	}
+}
+
+// StreamURLs implements playlist.Streamer, signing in first if needed.
+func (c *JellyfinClient) StreamURLs(id string) (path, fallback string, err error) {
+	if _, _, err := c.session(); err != nil {
+		return "", "", err
+	}
+	return c.streamURL(id, directContainers), c.streamURL(id, "mp3"), nil
+}
+
+// streamURL builds a universal audio URL for a track. The server sends the
+// original file if its container is among containers and transcodes it to
+// MP3 otherwise.
+func (c *JellyfinClient) streamURL(id, containers string) string {
+	token, userID, _ := c.session()
+	params := url.Values{
+		"UserId":               {userID},
+		"DeviceId":             {deviceID()},
+		"api_key":              {token},
+		"Container":            {containers},
+		"TranscodingContainer": {"mp3"},
+		"TranscodingProtocol":  {"http"},
+		"AudioCodec":           {"mp3"},
+	}
+	if c.MaxBitRate > 0 {
+		params.Set("MaxStreamingBitrate", strconv.Itoa(c.MaxBitRate*1000))
+	}
+	return c.URL + "/Audio/" + id + "/universal?" + params.Encode()
+}
@@ -0,0 +1,234 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"cliamp/playlist"
+)
+
+// fakeServer is a stand-in for the parts of the Jellyfin API the client
+// uses. The user "alice" with password "secret" signs in as user u1, and
+// the API key "key" is accepted for every user.
+type fakeServer struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	logins  int
+	expired bool // reject the current session token once
+	token   string
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *httptest.Server) {
+	f := &fakeServer{t: t}
+	srv := httptest.NewServer(f.handler())
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /Users/AuthenticateByName", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Username, Pw string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Username != "alice" || body.Pw != "secret" {
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		f.mu.Lock()
+		f.logins++
+		f.token = "tok" + strings.Repeat("+", f.logins-1)
+		token := f.token
+		f.mu.Unlock()
+		writeJSON(w, map[string]any{"AccessToken": token, "User": map[string]string{"Id": "u1"}})
+	})
+	mux.HandleFunc("GET /Users", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []map[string]any{
+			{"Id": "u1", "Name": "Alice", "Policy": map[string]bool{"IsAdministrator": false}},
+			{"Id": "u2", "Name": "root", "Policy": map[string]bool{"IsAdministrator": true}},
+		})
+	}))
+	mux.HandleFunc("GET /Playlists/p1/Items", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, itemsResult{Items: []item{
+			{ID: "t1", Name: "One", Album: "Album", AlbumArtist: "Band", RunTimeTicks: 90 * ticksPerSecond},
+			{ID: "t2", Name: "Two", Artists: []string{"A", "B"}},
+		}})
+	}))
+	mux.HandleFunc("GET /Users/{user}/Items", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, itemsResult{Items: []item{
+			{ID: "s1", Name: "Song", Type: "Audio", RunTimeTicks: 61 * ticksPerSecond},
+			{ID: "al1", Name: "Record", Type: "MusicAlbum", AlbumArtist: "Band", ChildCount: 1, ProductionYear: 1999},
+			{ID: "ar1", Name: "Band", Type: "MusicArtist"},
+		}})
+	}))
+	return mux
+}
+
+// authorized rejects requests without a valid token.
+func (f *fakeServer) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		token := f.token
+		expired := f.expired
+		f.expired = false
+		f.mu.Unlock()
+
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "MediaBrowser ") || !strings.Contains(auth, `DeviceId="cliamp-`) {
+			f.t.Errorf("Authorization = %q", auth)
+		}
+		if expired || !strings.Contains(auth, `Token="`+token+`"`) && !strings.Contains(auth, `Token="key"`) {
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       string
+		password   string
+		apiKey     string
+		wantToken  string
+		wantUserID string
+		wantErr    string
+	}{
+		{name: "password", user: "alice", password: "secret", wantToken: "tok", wantUserID: "u1"},
+		{name: "wrong password", user: "alice", password: "nope", wantErr: "jellyfin: wrong username or password"},
+		{name: "api key as user", user: "alice", apiKey: "key", wantToken: "key", wantUserID: "u1"},
+		{name: "api key as admin", apiKey: "key", wantToken: "key", wantUserID: "u2"},
+		{name: "api key unknown user", user: "bob", apiKey: "key", wantErr: `jellyfin: no user named "bob"`},
+		{name: "invalid api key", apiKey: "bad", wantErr: "jellyfin: invalid API key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := newFakeServer(t)
+			c := &JellyfinClient{URL: srv.URL, User: tt.user, Password: tt.password, APIKey: tt.apiKey}
+			token, userID, err := c.session()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != tt.wantToken || userID != tt.wantUserID {
+				t.Errorf("session = %q, %q, want %q, %q", token, userID, tt.wantToken, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestTracks(t *testing.T) {
+	_, srv := newFakeServer(t)
+	c := &JellyfinClient{URL: srv.URL, User: "alice", Password: "secret", MaxBitRate: 320}
+
+	tracks, err := c.Tracks("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want 2", len(tracks))
+	}
+	tests := []struct {
+		track              playlist.Track
+		title, artist, alb string
+	}{
+		{tracks[0], "One", "Band", "Album"},
+		{tracks[1], "Two", "A, B", ""},
+	}
+	for _, tt := range tests {
+		if tt.track.Title != tt.title || tt.track.Artist != tt.artist || tt.track.Album != tt.alb {
+			t.Errorf("track = %+v, want %q by %q on %q", tt.track, tt.title, tt.artist, tt.alb)
+		}
+	}
+
+	u, err := url.Parse(tracks[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"api_key":             "tok",
+		"UserId":              "u1",
+		"Container":           directContainers,
+		"MaxStreamingBitrate": "320000",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("stream URL %s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+	if u.Path != "/Audio/t1/universal" {
+		t.Errorf("stream path = %q", u.Path)
+	}
+	if fb, _ := url.Parse(tracks[0].Fallback); fb.Query().Get("Container") != "mp3" {
+		t.Errorf("fallback = %q, want an MP3 stream", tracks[0].Fallback)
+	}
+
+	path, fallback, err := c.StreamURLs("t1")
+	if err != nil || path != tracks[0].Path || fallback != tracks[0].Fallback {
+		t.Errorf("StreamURLs = %q, %q, %v, want the track's URLs", path, fallback, err)
+	}
+}
+
+func TestRenewsExpiredSession(t *testing.T) {
+	f, srv := newFakeServer(t)
+	c := &JellyfinClient{URL: srv.URL, User: "alice", Password: "secret"}
+	if _, err := c.Playlists(); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	f.expired = true
+	f.mu.Unlock()
+	if _, err := c.Tracks("p1"); err != nil {
+		t.Fatal(err)
+	}
+	if f.logins != 2 {
+		t.Errorf("signed in %d times, want 2", f.logins)
+	}
+	if token, _, _ := c.session(); token != "tok+" {
+		t.Errorf("token = %q, want the renewed one", token)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	_, srv := newFakeServer(t)
+	c := &JellyfinClient{URL: srv.URL, APIKey: "key"}
+
+	entries, err := c.Search("band")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][3]string
+	for _, e := range entries {
+		got = append(got, [3]string{e.ID, e.Name, e.Info})
+	}
+	want := [][3]string{
+		{"artist:ar1", "Band", "artist"},
+		{"album:al1", "Band - Record", "album, 1999, 1 track"},
+		{"s1", "Song", "1:01"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Search = %q, want %q", got, want)
+	}
+	if entries[2].Track == nil || entries[2].Track.ID != "s1" {
+		t.Errorf("song entry has track %+v", entries[2].Track)
+	}
+}
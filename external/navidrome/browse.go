@@ -0,0 +1,338 @@
+package navidrome
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"cliamp/playlist"
+)
+
+const (
+	// albumListSize is how many albums are fetched for album lists.
+	albumListSize = 200
+
+	// searchCount is how many artists, albums and songs a search returns.
+	searchCount = 20
+)
+
+// Browse IDs are prefixed with the kind of node they refer to, e.g.
+// "artist:ID" or "albums:newest".
+const (
+	browsePlaylists = "playlists"
+	browseArtists   = "artists"
+	browseGenres    = "genres"
+	browseStarred   = "starred"
+	prefixPlaylist  = "playlist:"
+	prefixArtist    = "artist:"
+	prefixAlbum     = "album:"
+	prefixAlbumList = "albums:"
+	prefixGenre     = "genre:"
+)
+
+type subsonicSong struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	Artist     string `json:"artist"`
+	Album      string `json:"album"`
+	Duration   int    `json:"duration"` // seconds
+	Starred    string `json:"starred"`  // timestamp, empty if not starred
+	UserRating int    `json:"userRating"`
+}
+
+type subsonicAlbum struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Artist    string `json:"artist"`
+	Year      int    `json:"year"`
+	SongCount int    `json:"songCount"`
+}
+
+// Browse implements playlist.Browser over the Subsonic library endpoints.
+func (c *NavidromeClient) Browse(id string) ([]playlist.Entry, error) {
+	switch {
+	case id == "":
+		// The root is the first request made, so check the credentials
+		// here and fail with a clear error instead of an empty library.
+		if err := c.Ping(); err != nil {
+			return nil, err
+		}
+		return []playlist.Entry{
+			{ID: browsePlaylists, Name: "Playlists"},
+			{ID: browseStarred, Name: "Starred"},
+			{ID: browseArtists, Name: "Artists"},
+			{ID: prefixAlbumList + "newest", Name: "Recently Added"},
+			{ID: prefixAlbumList + "recent", Name: "Recently Played"},
+			{ID: prefixAlbumList + "frequent", Name: "Most Played"},
+			{ID: prefixAlbumList + "random", Name: "Random"},
+			{ID: browseGenres, Name: "Genres"},
+		}, nil
+	case id == browsePlaylists:
+		return c.playlistEntries()
+	case id == browseArtists:
+		return c.Artists()
+	case id == browseGenres:
+		return c.Genres()
+	case id == browseStarred:
+		return c.Starred()
+	case strings.HasPrefix(id, prefixPlaylist):
+		songs, err := c.playlistSongs(strings.TrimPrefix(id, prefixPlaylist))
+		if err != nil {
+			return nil, err
+		}
+		return c.songEntries(songs), nil
+	case strings.HasPrefix(id, prefixArtist):
+		return c.Artist(strings.TrimPrefix(id, prefixArtist))
+	case strings.HasPrefix(id, prefixAlbum):
+		return c.Album(strings.TrimPrefix(id, prefixAlbum))
+	case strings.HasPrefix(id, prefixAlbumList):
+		return c.AlbumList(strings.TrimPrefix(id, prefixAlbumList), nil)
+	case strings.HasPrefix(id, prefixGenre):
+		genre := strings.TrimPrefix(id, prefixGenre)
+		return c.AlbumList("byGenre", url.Values{"genre": {genre}})
+	}
+	return nil, fmt.Errorf("unknown library entry %q", id)
+}
+
+func (c *NavidromeClient) playlistEntries() ([]playlist.Entry, error) {
+	lists, err := c.Playlists()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]playlist.Entry, len(lists))
+	for i, p := range lists {
+		entries[i] = playlist.Entry{
+			ID:   prefixPlaylist + p.ID,
+			Name: p.Name,
+			Info: plural(p.TrackCount, "track"),
+		}
+	}
+	return entries, nil
+}
+
+// Artists lists all artists in the library (getArtists).
+func (c *NavidromeClient) Artists() ([]playlist.Entry, error) {
+	var result struct {
+		Artists struct {
+			Index []struct {
+				Artist []struct {
+					ID         string `json:"id"`
+					Name       string `json:"name"`
+					AlbumCount int    `json:"albumCount"`
+				} `json:"artist"`
+			} `json:"index"`
+		} `json:"artists"`
+	}
+	if err := c.get("getArtists", nil, &result); err != nil {
+		return nil, err
+	}
+
+	var entries []playlist.Entry
+	for _, idx := range result.Artists.Index {
+		for _, a := range idx.Artist {
+			entries = append(entries, playlist.Entry{
+				ID:   prefixArtist + a.ID,
+				Name: a.Name,
+				Info: plural(a.AlbumCount, "album"),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// Artist lists the albums of an artist (getArtist).
+func (c *NavidromeClient) Artist(id string) ([]playlist.Entry, error) {
+	var result struct {
+		Artist struct {
+			Album []subsonicAlbum `json:"album"`
+		} `json:"artist"`
+	}
+	if err := c.get("getArtist", url.Values{"id": {id}}, &result); err != nil {
+		return nil, err
+	}
+	return albumEntries(result.Artist.Album, false), nil
+}
+
+// Album lists the tracks of an album (getAlbum).
+func (c *NavidromeClient) Album(id string) ([]playlist.Entry, error) {
+	var result struct {
+		Album struct {
+			Song []subsonicSong `json:"song"`
+		} `json:"album"`
+	}
+	if err := c.get("getAlbum", url.Values{"id": {id}}, &result); err != nil {
+		return nil, err
+	}
+	return c.songEntries(result.Album.Song), nil
+}
+
+// AlbumList lists albums by type: "newest", "recent", "frequent",
+// "random", "byGenre" and others supported by getAlbumList2.
+func (c *NavidromeClient) AlbumList(listType string, params url.Values) ([]playlist.Entry, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("type", listType)
+	params.Set("size", strconv.Itoa(albumListSize))
+
+	var result struct {
+		AlbumList2 struct {
+			Album []subsonicAlbum `json:"album"`
+		} `json:"albumList2"`
+	}
+	if err := c.get("getAlbumList2", params, &result); err != nil {
+		return nil, err
+	}
+	return albumEntries(result.AlbumList2.Album, true), nil
+}
+
+// Genres lists the genres in the library (getGenres).
+func (c *NavidromeClient) Genres() ([]playlist.Entry, error) {
+	var result struct {
+		Genres struct {
+			Genre []struct {
+				Value      string `json:"value"`
+				AlbumCount int    `json:"albumCount"`
+			} `json:"genre"`
+		} `json:"genres"`
+	}
+	if err := c.get("getGenres", nil, &result); err != nil {
+		return nil, err
+	}
+
+	var entries []playlist.Entry
+	for _, g := range result.Genres.Genre {
+		if g.AlbumCount == 0 {
+			continue
+		}
+		entries = append(entries, playlist.Entry{
+			ID:   prefixGenre + g.Value,
+			Name: g.Value,
+			Info: plural(g.AlbumCount, "album"),
+		})
+	}
+	return entries, nil
+}
+
+// Starred lists the starred songs (getStarred2).
+func (c *NavidromeClient) Starred() ([]playlist.Entry, error) {
+	var result struct {
+		Starred2 struct {
+			Song []subsonicSong `json:"song"`
+		} `json:"starred2"`
+	}
+	if err := c.get("getStarred2", nil, &result); err != nil {
+		return nil, err
+	}
+	return c.songEntries(result.Starred2.Song), nil
+}
+
+// SetStarred implements playlist.Rater using star and unstar.
+func (c *NavidromeClient) SetStarred(id string, starred bool) error {
+	endpoint := "unstar"
+	if starred {
+		endpoint = "star"
+	}
+	return c.get(endpoint, url.Values{"id": {id}}, nil)
+}
+
+// SetRating implements playlist.Rater using setRating.
+func (c *NavidromeClient) SetRating(id string, rating int) error {
+	return c.get("setRating", url.Values{"id": {id}, "rating": {strconv.Itoa(rating)}}, nil)
+}
+
+// albumEntries converts albums to entries, prefixing the artist name for
+// lists that mix artists.
+func albumEntries(albums []subsonicAlbum, withArtist bool) []playlist.Entry {
+	entries := make([]playlist.Entry, len(albums))
+	for i, a := range albums {
+		name := a.Name
+		if withArtist && a.Artist != "" {
+			name = a.Artist + " - " + a.Name
+		}
+		info := plural(a.SongCount, "track")
+		if a.Year > 0 {
+			info = strconv.Itoa(a.Year) + ", " + info
+		}
+		entries[i] = playlist.Entry{ID: prefixAlbum + a.ID, Name: name, Info: info}
+	}
+	return entries
+}
+
+func (c *NavidromeClient) songEntries(songs []subsonicSong) []playlist.Entry {
+	entries := make([]playlist.Entry, len(songs))
+	for i, s := range songs {
+		t := c.track(s)
+		entries[i] = playlist.Entry{
+			ID:    s.ID,
+			Name:  t.DisplayName(),
+			Info:  fmt.Sprintf("%d:%02d", s.Duration/60, s.Duration%60),
+			Track: &t,
+		}
+	}
+	return entries
+}
+
+// track converts a Subsonic song into a streamable playlist track.
+func (c *NavidromeClient) track(s subsonicSong) playlist.Track {
+	path, fallback, _ := c.StreamURLs(s.ID)
+	return playlist.Track{
+		Path:     path,
+		Fallback: fallback,
+		Title:    s.Title,
+		Artist:   s.Artist,
+		Album:    s.Album,
+		ID:       s.ID,
+		Starred:  s.Starred != "",
+		Rating:   s.UserRating,
+	}
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// Search implements playlist.Searcher using search3, returning matching
+// artists, then albums, then songs.
+func (c *NavidromeClient) Search(query string) ([]playlist.Entry, error) {
+	params := url.Values{
+		"query":       {query},
+		"artistCount": {strconv.Itoa(searchCount)},
+		"albumCount":  {strconv.Itoa(searchCount)},
+		"songCount":   {strconv.Itoa(searchCount)},
+	}
+	var result struct {
+		SearchResult3 struct {
+			Artist []struct {
+				ID         string `json:"id"`
+				Name       string `json:"name"`
+				AlbumCount int    `json:"albumCount"`
+			} `json:"artist"`
+			Album []subsonicAlbum `json:"album"`
+			Song  []subsonicSong  `json:"song"`
+		} `json:"searchResult3"`
+	}
+	if err := c.get("search3", params, &result); err != nil {
+		return nil, err
+	}
+
+	r := result.SearchResult3
+	var entries []playlist.Entry
+	for _, a := range r.Artist {
+		entries = append(entries, playlist.Entry{
+			ID:   prefixArtist + a.ID,
+			Name: a.Name,
+			Info: "artist, " + plural(a.AlbumCount, "album"),
+		})
+	}
+	for _, e := range albumEntries(r.Album, true) {
+		e.Info = "album, " + e.Info
+		entries = append(entries, e)
+	}
+	entries = append(entries, c.songEntries(r.Song)...)
+	return entries, nil
+}
@@ -1,23 +1,71 @@
 package navidrome
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"cliamp/playlist"
 )
 
+const (
+	// apiVersion is the Subsonic API version sent with every request.
+	apiVersion = "1.16.1"
+
+	// maxAttempts is how often a failing read request is tried.
+	maxAttempts = 3
+
+	// retryDelay is the wait before the first retry; it doubles each time.
+	retryDelay = 500 * time.Millisecond
+)
+
+// httpClient is shared by all API requests. Streams are opened by the
+// player and are not subject to this timeout.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// noRetry lists endpoints that change state on every call and must not be
+// repeated after a failure that may have reached the server.
+var noRetry = map[string]bool{
+	"scrobble": true,
+}
+
+// NavidromeClient talks to a Navidrome (or other Subsonic-compatible)
+// server. It authenticates with APIKey if set; otherwise with User and
+// Password, sent as a salted token or, with LegacyAuth, as a hex-encoded
+// password for servers that cannot verify tokens (e.g. LDAP-backed users).
+//
+// Format selects the stream format ("raw" for the original file, or a
+// transcoding such as "opus", "mp3" or "flac"; empty means "mp3") and
+// MaxBitRate caps the bitrate in kbps (0 for the server default).
 type NavidromeClient struct {
-	URL      string
-	User     string
-	Password string
+	Label      string // display name, "" for "Navidrome"
+	URL        string
+	User       string
+	Password   string
+	APIKey     string
+	LegacyAuth bool
+	Format     string
+	MaxBitRate int
 }
 
+// Stream formats.
+const (
+	FormatRaw  = "raw"
+	FormatOpus = "opus"
+	FormatMP3  = "mp3"
+	FormatFLAC = "flac"
+)
+
+// Formats lists the stream formats that can be requested.
+var Formats = []string{FormatRaw, FormatOpus, FormatMP3, FormatFLAC}
+
 type NavidromePlaylist struct {
 	ID    string `json:"id"`
 	Name  string `json:"name"`
@@ -31,21 +79,30 @@ type NavidromeTrack struct {
 }
 
 func (c *NavidromeClient) Name() string {
+	if c.Label != "" {
+		return c.Label
+	}
 	return "Navidrome"
 }
 
 func (c *NavidromeClient) buildURL(endpoint string, params url.Values) string {
-	salt := fmt.Sprintf("%d", time.Now().UnixNano())
-	hash := md5.Sum([]byte(c.Password + salt))
-	token := hex.EncodeToString(hash[:])
-
 	if params == nil {
 		params = url.Values{}
 	}
-	params.Set("u", c.User)
-	params.Set("t", token)
-	params.Set("s", salt)
-	params.Set("v", "1.0.0")
+	switch {
+	case c.APIKey != "":
+		params.Set("apiKey", c.APIKey)
+	case c.LegacyAuth:
+		params.Set("u", c.User)
+		params.Set("p", "enc:"+hex.EncodeToString([]byte(c.Password)))
+	default:
+		salt := fmt.Sprintf("%d", time.Now().UnixNano())
+		hash := md5.Sum([]byte(c.Password + salt))
+		params.Set("u", c.User)
+		params.Set("t", hex.EncodeToString(hash[:]))
+		params.Set("s", salt)
+	}
+	params.Set("v", apiVersion)
 	params.Set("c", "cliamp")
 	params.Set("f", "json")
 
@@ -53,29 +110,21 @@ func (c *NavidromeClient) buildURL(endpoint string, params url.Values) string {
 }
 
 func (c *NavidromeClient) Playlists() ([]playlist.PlaylistInfo, error) {
-	resp, err := http.Get(c.buildURL("getPlaylists", nil))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
 	var result struct {
-		SubsonicResponse struct {
-			Playlists struct {
-				Playlist []struct {
-					ID    string `json:"id"`
-					Name  string `json:"name"`
-					Count int    `json:"songCount"`
-				} `json:"playlist"`
-			} `json:"playlists"`
-		} `json:"subsonic-response"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		Playlists struct {
+			Playlist []struct {
+				ID    string `json:"id"`
+				Name  string `json:"name"`
+				Count int    `json:"songCount"`
+			} `json:"playlist"`
+		} `json:"playlists"`
+	}
+	if err := c.get("getPlaylists", nil, &result); err != nil {
 		return nil, err
 	}
 
 	var lists []playlist.PlaylistInfo
-	for _, p := range result.SubsonicResponse.Playlists.Playlist {
+	for _, p := range result.Playlists.Playlist {
 		lists = append(lists, playlist.PlaylistInfo{
 			ID:         p.ID,
 			Name:       p.Name,
@@ -86,39 +135,173 @@ func (c *NavidromeClient) Playlists() ([]playlist.PlaylistInfo, error) {
 }
 
 func (c *NavidromeClient) Tracks(id string) ([]playlist.Track, error) {
-	resp, err := http.Get(c.buildURL("getPlaylist", url.Values{"id": {id}}))
+	songs, err := c.playlistSongs(id)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	var tracks []playlist.Track
+	for _, s := range songs {
+		tracks = append(tracks, c.track(s))
+	}
+	return tracks, nil
+}
 
+func (c *NavidromeClient) playlistSongs(id string) ([]subsonicSong, error) {
 	var result struct {
-		SubsonicResponse struct {
-			Playlist struct {
-				Entry []struct {
-					ID     string `json:"id"`
-					Title  string `json:"title"`
-					Artist string `json:"artist"`
-				} `json:"entry"`
-			} `json:"playlist"`
-		} `json:"subsonic-response"`
+		Playlist struct {
+			Entry []subsonicSong `json:"entry"`
+		} `json:"playlist"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := c.get("getPlaylist", url.Values{"id": {id}}, &result); err != nil {
 		return nil, err
 	}
+	return result.Playlist.Entry, nil
+}
 
-	var tracks []playlist.Track
-	for _, t := range result.SubsonicResponse.Playlist.Entry {
-		tracks = append(tracks, playlist.Track{
-			Path:   c.streamURL(t.ID),
-			Title:  t.Title,
-			Artist: t.Artist,
-		})
+// Scrobble reports a play to the server so that play counts, "now playing"
+// and smart playlists stay up to date.
+func (c *NavidromeClient) Scrobble(id string, at time.Time, submission bool) error {
+	params := url.Values{
+		"id":         {id},
+		"time":       {strconv.FormatInt(at.UnixMilli(), 10)},
+		"submission": {strconv.FormatBool(submission)},
 	}
-	return tracks, nil
+	return c.get("scrobble", params, nil)
+}
+
+// Ping checks that the server is reachable and accepts the credentials.
+func (c *NavidromeClient) Ping() error {
+	return c.get("ping", nil, nil)
 }
 
-// StreamURL generates the authenticated streaming URL for a track ID.
-func (c *NavidromeClient) streamURL(id string) string {
-	return c.buildURL("stream", url.Values{"id": {id}, "format": {"mp3"}})
+// get calls a Subsonic endpoint and decodes the contents of the
+// "subsonic-response" object into out, if set.
+func (c *NavidromeClient) get(endpoint string, params url.Values, out any) error {
+	return c.getContext(context.Background(), endpoint, params, out)
+}
+
+// getContext is get with a context. Network errors, 5xx and 429 responses
+// are retried with backoff unless the endpoint is listed in noRetry; the
+// backoff ends early when ctx is done.
+func (c *NavidromeClient) getContext(ctx context.Context, endpoint string, params url.Values, out any) error {
+	attempts := maxAttempts
+	if noRetry[endpoint] {
+		attempts = 1
+	}
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := c.do(ctx, endpoint, params, out)
+		if !retry || attempt == attempts-1 {
+			return err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		delay *= 2
+	}
+}
+
+// do performs a single request. It reports whether a failure is worth
+// retrying.
+func (c *NavidromeClient) do(ctx context.Context, endpoint string, params url.Values, out any) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.buildURL(endpoint, params), nil)
+	if err != nil {
+		// The error would quote the URL and its credentials
+		return false, fmt.Errorf("navidrome %s: invalid server URL %q", endpoint, c.URL)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, fmt.Errorf("navidrome %s: %w", endpoint, ctx.Err())
+		}
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			// Don't leak credentials from the request URL.
+			err = uerr.Err
+		}
+		return true, fmt.Errorf("navidrome %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		SubsonicResponse json.RawMessage `json:"subsonic-response"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+
+	if resp.StatusCode != http.StatusOK {
+		// Some servers report failed authentication with a 401 or 403
+		// carrying a regular Subsonic error body.
+		if decodeErr == nil {
+			if err := checkStatus(endpoint, result.SubsonicResponse); err != nil {
+				return false, err
+			}
+		}
+		herr := &HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode, Status: resp.Status}
+		return herr.temporary(), herr
+	}
+	if decodeErr != nil {
+		return false, fmt.Errorf("navidrome %s: invalid response: %w", endpoint, decodeErr)
+	}
+	if err := checkStatus(endpoint, result.SubsonicResponse); err != nil {
+		return false, err
+	}
+	if out == nil {
+		return false, nil
+	}
+	return false, json.Unmarshal(result.SubsonicResponse, out)
+}
+
+// checkStatus returns the error carried by a "failed" Subsonic response.
+func checkStatus(endpoint string, body json.RawMessage) error {
+	var status struct {
+		Status string `json:"status"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if len(body) == 0 {
+		return fmt.Errorf("navidrome %s: not a Subsonic response", endpoint)
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("navidrome %s: invalid response: %w", endpoint, err)
+	}
+	if status.Status == "ok" {
+		return nil
+	}
+	e := &Error{Endpoint: endpoint}
+	if status.Error != nil {
+		e.Code, e.Message = status.Error.Code, status.Error.Message
+	}
+	return e
+}
+
+// streamURL generates the authenticated streaming URL for a track ID in
+// the given format.
+func (c *NavidromeClient) streamURL(id, format string) string {
+	params := url.Values{"id": {id}, "format": {format}}
+	if c.MaxBitRate > 0 {
+		params.Set("maxBitRate", strconv.Itoa(c.MaxBitRate))
+	}
+	return c.buildURL("stream", params)
+}
+
+// StreamURLs implements playlist.Streamer. It returns the URL for the
+// configured format and, unless that already is MP3, an MP3 transcode to
+// fall back on when the player cannot decode what the server sends (e.g.
+// Opus or AAC without ffmpeg).
+func (c *NavidromeClient) StreamURLs(id string) (primary, fallback string, err error) {
+	format := c.Format
+	if format == "" {
+		format = FormatMP3
+	}
+	primary = c.streamURL(id, format)
+	if format != FormatMP3 {
+		fallback = c.streamURL(id, FormatMP3)
+	}
+	return primary, fallback, nil
 }
@@ -0,0 +1,118 @@
+package navidrome
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const okBody = `{"subsonic-response": {"status": "ok", "version": "1.16.1"}}`
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		responses []int // status per call; the last one repeats
+		body      string
+		wantCalls int32
+		wantErr   bool
+		maxTime   time.Duration // 0 for no limit
+	}{
+		{name: "ok", endpoint: "ping", responses: []int{200}, body: okBody, wantCalls: 1},
+		{name: "recovers", endpoint: "ping", responses: []int{503, 200}, body: okBody, wantCalls: 2},
+		{
+			// Backs off twice and does not wait after the last attempt
+			name:      "gives up",
+			endpoint:  "ping",
+			responses: []int{503},
+			wantCalls: maxAttempts,
+			wantErr:   true,
+			maxTime:   3*retryDelay + 250*time.Millisecond,
+		},
+		{name: "rate limited", endpoint: "ping", responses: []int{429, 200}, body: okBody, wantCalls: 2},
+		{name: "not found", endpoint: "ping", responses: []int{404}, wantCalls: 1, wantErr: true},
+		{name: "scrobble once", endpoint: "scrobble", responses: []int{503}, wantCalls: 1, wantErr: true},
+		{
+			name:      "subsonic error",
+			endpoint:  "ping",
+			responses: []int{200},
+			body:      `{"subsonic-response": {"status": "failed", "error": {"code": 40, "message": "Wrong username or password"}}}`,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1)) - 1
+				code := tt.responses[min(n, len(tt.responses)-1)]
+				w.WriteHeader(code)
+				if code == http.StatusOK {
+					fmt.Fprint(w, tt.body)
+				}
+			}))
+			defer srv.Close()
+
+			c := &NavidromeClient{URL: srv.URL, User: "u", Password: "p"}
+			start := time.Now()
+			err := c.get(tt.endpoint, nil, nil)
+			if d := time.Since(start); tt.maxTime > 0 && d > tt.maxTime {
+				t.Errorf("took %v, want at most %v", d, tt.maxTime)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("%d calls, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel() // cancelled while waiting to retry
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := &NavidromeClient{URL: srv.URL, APIKey: "k"}
+	start := time.Now()
+	err := c.getContext(ctx, "ping", nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d >= retryDelay {
+		t.Errorf("took %v, want no backoff", d)
+	}
+}
+
+func TestErrorsHideCredentials(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"unreachable", "http://127.0.0.1:1"},
+		{"invalid", "http://bad host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &NavidromeClient{URL: tt.url, User: "u", Password: "hunter2", LegacyAuth: true}
+			err := c.getContext(context.Background(), "scrobble", nil, nil)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if strings.Contains(err.Error(), "p=enc") || strings.Contains(err.Error(), "hunter2") {
+				t.Errorf("error leaks the password: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package navidrome
+
+import "fmt"
+
+// Subsonic API error codes.
+const (
+	ErrGeneric          = 0
+	ErrMissingParameter = 10
+	ErrClientTooOld     = 20
+	ErrServerTooOld     = 30
+	ErrWrongCredentials = 40
+	ErrTokenAuthLDAP    = 41
+	ErrAuthUnsupported  = 42
+	ErrConflictingAuth  = 43
+	ErrInvalidAPIKey    = 44
+	ErrNotAuthorized    = 50
+	ErrTrialExpired     = 60
+	ErrNotFound         = 70
+)
+
+// Error is an error reported by the server in a "failed" Subsonic response.
+type Error struct {
+	Endpoint string
+	Code     int
+	Message  string
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if hint := errorHints[e.Code]; hint != "" {
+		msg = hint
+	}
+	if msg == "" {
+		msg = "request failed"
+	}
+	return fmt.Sprintf("navidrome %s: %s (error %d)", e.Endpoint, msg, e.Code)
+}
+
+// errorHints replaces server messages for errors users can act on.
+var errorHints = map[int]string{
+	ErrClientTooOld:     "server requires a newer Subsonic API version",
+	ErrServerTooOld:     "server is too old for this client",
+	ErrWrongCredentials: "wrong username or password",
+	ErrTokenAuthLDAP:    "token authentication is not supported for LDAP users; enable legacy_auth",
+	ErrAuthUnsupported:  "authentication mechanism not supported by the server",
+	ErrConflictingAuth:  "conflicting authentication; set either an API key or a username and password",
+	ErrInvalidAPIKey:    "invalid API key",
+	ErrNotAuthorized:    "user is not authorized for this operation",
+}
+
+// HTTPError is returned when the server answers with a non-200 status.
+type HTTPError struct {
+	Endpoint   string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("navidrome %s: %s", e.Endpoint, e.Status)
+}
+
+// temporary reports whether a request failing with this status may
+// succeed when retried.
+func (e *HTTPError) temporary() bool {
+	return e.StatusCode == 429 || e.StatusCode >= 500
+}
@@ -0,0 +1,219 @@
+package plex
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"cliamp/playlist"
+)
+
+const (
+	// albumListSize is how many albums are fetched for album lists.
+	albumListSize = 200
+
+	// searchCount is how many artists, albums and songs a search returns.
+	searchCount = 20
+)
+
+// Plex metadata types used in library queries.
+const (
+	typeArtist = "8"
+	typeAlbum  = "9"
+)
+
+// Browse IDs are prefixed with the kind of node they refer to, e.g.
+// "section:KEY" or "album:KEY".
+const (
+	browsePlaylists = "playlists"
+	prefixPlaylist  = "playlist:"
+	prefixSection   = "section:"
+	prefixArtists   = "artists:"
+	prefixAlbums    = "albums:"
+	prefixRecent    = "recent:"
+	prefixArtist    = "artist:"
+	prefixAlbum     = "album:"
+)
+
+// Browse implements playlist.Browser over the server's playlists and music
+// library sections.
+func (c *PlexClient) Browse(id string) ([]playlist.Entry, error) {
+	switch {
+	case id == "":
+		return c.root()
+	case id == browsePlaylists:
+		return c.playlistEntries()
+	case strings.HasPrefix(id, prefixPlaylist):
+		items, err := c.metadataList("/playlists/"+strings.TrimPrefix(id, prefixPlaylist)+"/items", nil)
+		if err != nil {
+			return nil, err
+		}
+		return c.trackEntries(items), nil
+	case strings.HasPrefix(id, prefixSection):
+		key := strings.TrimPrefix(id, prefixSection)
+		return []playlist.Entry{
+			{ID: prefixArtists + key, Name: "Artists"},
+			{ID: prefixAlbums + key, Name: "Albums"},
+			{ID: prefixRecent + key, Name: "Recently Added"},
+		}, nil
+	case strings.HasPrefix(id, prefixArtists):
+		items, err := c.sectionItems(strings.TrimPrefix(id, prefixArtists), typeArtist, "titleSort")
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]playlist.Entry, len(items))
+		for i, m := range items {
+			entries[i] = playlist.Entry{ID: prefixArtist + m.RatingKey, Name: m.Title, Info: plural(m.ChildCount, "album")}
+		}
+		return entries, nil
+	case strings.HasPrefix(id, prefixAlbums):
+		items, err := c.sectionItems(strings.TrimPrefix(id, prefixAlbums), typeAlbum, "artist.titleSort,titleSort")
+		if err != nil {
+			return nil, err
+		}
+		return albumEntries(items, true), nil
+	case strings.HasPrefix(id, prefixRecent):
+		items, err := c.sectionItems(strings.TrimPrefix(id, prefixRecent), typeAlbum, "addedAt:desc")
+		if err != nil {
+			return nil, err
+		}
+		return albumEntries(items, true), nil
+	case strings.HasPrefix(id, prefixArtist):
+		items, err := c.children(strings.TrimPrefix(id, prefixArtist))
+		if err != nil {
+			return nil, err
+		}
+		return albumEntries(items, false), nil
+	case strings.HasPrefix(id, prefixAlbum):
+		items, err := c.children(strings.TrimPrefix(id, prefixAlbum))
+		if err != nil {
+			return nil, err
+		}
+		return c.trackEntries(items), nil
+	}
+	return nil, fmt.Errorf("unknown library entry %q", id)
+}
+
+// root lists the playlists followed by the music library sections. It is
+// the first request made, so a bad token fails here with a clear error.
+func (c *PlexClient) root() ([]playlist.Entry, error) {
+	var result container
+	if err := c.get("/library/sections", nil, &result); err != nil {
+		return nil, err
+	}
+	entries := []playlist.Entry{{ID: browsePlaylists, Name: "Playlists"}}
+	for _, d := range result.MediaContainer.Directory {
+		if d.Type == "artist" {
+			entries = append(entries, playlist.Entry{ID: prefixSection + d.Key, Name: d.Title, Info: "library"})
+		}
+	}
+	return entries, nil
+}
+
+func (c *PlexClient) playlistEntries() ([]playlist.Entry, error) {
+	lists, err := c.Playlists()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]playlist.Entry, len(lists))
+	for i, p := range lists {
+		entries[i] = playlist.Entry{
+			ID:   prefixPlaylist + p.ID,
+			Name: p.Name,
+			Info: plural(p.TrackCount, "track"),
+		}
+	}
+	return entries, nil
+}
+
+// sectionItems lists the items of one type in a library section.
+func (c *PlexClient) sectionItems(section, itemType, sort string) ([]metadata, error) {
+	return c.metadataList("/library/sections/"+section+"/all", url.Values{
+		"type":                   {itemType},
+		"sort":                   {sort},
+		"X-Plex-Container-Start": {"0"},
+		"X-Plex-Container-Size":  {strconv.Itoa(albumListSize)},
+	})
+}
+
+// children lists the albums of an artist or the tracks of an album.
+func (c *PlexClient) children(key string) ([]metadata, error) {
+	return c.metadataList("/library/metadata/"+key+"/children", nil)
+}
+
+// albumEntries converts albums to entries, prefixing the artist name for
+// lists that mix artists.
+func albumEntries(albums []metadata, withArtist bool) []playlist.Entry {
+	entries := make([]playlist.Entry, len(albums))
+	for i, a := range albums {
+		name := a.Title
+		if withArtist && a.ParentTitle != "" {
+			name = a.ParentTitle + " - " + a.Title
+		}
+		info := plural(a.LeafCount, "track")
+		if a.Year > 0 {
+			info = strconv.Itoa(a.Year) + ", " + info
+		}
+		entries[i] = playlist.Entry{ID: prefixAlbum + a.RatingKey, Name: name, Info: info}
+	}
+	return entries
+}
+
+func (c *PlexClient) trackEntries(items []metadata) []playlist.Entry {
+	var entries []playlist.Entry
+	for _, m := range items {
+		t, ok := c.track(m)
+		if !ok {
+			continue
+		}
+		secs := m.Duration / 1000
+		entries = append(entries, playlist.Entry{
+			ID:    m.RatingKey,
+			Name:  t.DisplayName(),
+			Info:  fmt.Sprintf("%d:%02d", secs/60, secs%60),
+			Track: &t,
+		})
+	}
+	return entries
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// Search implements playlist.Searcher using the server's search hubs,
+// returning matching artists, then albums, then tracks.
+func (c *PlexClient) Search(query string) ([]playlist.Entry, error) {
+	var result container
+	params := url.Values{"query": {query}, "limit": {strconv.Itoa(searchCount)}}
+	if err := c.get("/hubs/search", params, &result); err != nil {
+		return nil, err
+	}
+
+	var artists, albums, tracks []metadata
+	for _, h := range result.MediaContainer.Hub {
+		switch h.Type {
+		case "artist":
+			artists = append(artists, h.Metadata...)
+		case "album":
+			albums = append(albums, h.Metadata...)
+		case "track":
+			tracks = append(tracks, h.Metadata...)
+		}
+	}
+
+	var entries []playlist.Entry
+	for _, a := range artists {
+		entries = append(entries, playlist.Entry{ID: prefixArtist + a.RatingKey, Name: a.Title, Info: "artist"})
+	}
+	for _, e := range albumEntries(albums, true) {
+		e.Info = "album, " + e.Info
+		entries = append(entries, e)
+	}
+	entries = append(entries, c.trackEntries(tracks)...)
+	return entries, nil
+}
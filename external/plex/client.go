@@ -0,0 +1,268 @@
+// Package plex implements a playlist provider for Plex Media Server music
+// libraries.
+package plex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cliamp/playlist"
+)
+
+const (
+	product = "cliamp"
+
+	// libraryIdentifier identifies the library to the scrobble and rate
+	// endpoints.
+	libraryIdentifier = "com.plexapp.plugins.library"
+)
+
+// httpClient is shared by all API requests. Streams are opened by the
+// player and are not subject to this timeout.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// PlexClient talks to a Plex Media Server using an X-Plex-Token.
+type PlexClient struct {
+	Label string // display name, "" for "Plex"
+	URL   string
+	Token string
+
+	mu        sync.Mutex
+	durations map[string]int // track duration in ms by rating key, for timeline reports
+}
+
+func (c *PlexClient) Name() string {
+	if c.Label != "" {
+		return c.Label
+	}
+	return "Plex"
+}
+
+// metadata is the subset of a Plex Metadata element used by the client.
+// Tracks carry their artist in grandparentTitle and album in parentTitle,
+// albums their artist in parentTitle.
+type metadata struct {
+	RatingKey        string  `json:"ratingKey"`
+	Type             string  `json:"type"`
+	Title            string  `json:"title"`
+	ParentTitle      string  `json:"parentTitle"`
+	GrandparentTitle string  `json:"grandparentTitle"`
+	OriginalTitle    string  `json:"originalTitle"` // track artist, if it differs from the album artist
+	Year             int     `json:"year"`
+	LeafCount        int     `json:"leafCount"` // tracks in an album or playlist
+	ChildCount       int     `json:"childCount"`
+	Duration         int     `json:"duration"`   // milliseconds
+	UserRating       float64 `json:"userRating"` // 0-10
+	Media            []struct {
+		Part []struct {
+			Key string `json:"key"`
+		} `json:"Part"`
+	} `json:"Media"`
+}
+
+type container struct {
+	MediaContainer struct {
+		Metadata  []metadata `json:"Metadata"`
+		Directory []struct {
+			Key   string `json:"key"`
+			Type  string `json:"type"`
+			Title string `json:"title"`
+		} `json:"Directory"`
+		Hub []struct {
+			Type     string     `json:"type"`
+			Metadata []metadata `json:"Metadata"`
+		} `json:"Hub"`
+	} `json:"MediaContainer"`
+}
+
+// clientID identifies this machine to the server in session and timeline
+// reports.
+func clientID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return product
+	}
+	return product + "-" + host
+}
+
+// get calls an API path and decodes the JSON MediaContainer into out.
+func (c *PlexClient) get(path string, params url.Values, out any) error {
+	u := c.URL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Plex-Token", c.Token)
+	req.Header.Set("X-Plex-Product", product)
+	req.Header.Set("X-Plex-Client-Identifier", clientID())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("plex %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errors.New("plex: invalid token")
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("plex %s: %s", path, resp.Status)
+	case out == nil:
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("plex %s: invalid response: %w", path, err)
+	}
+	return nil
+}
+
+// metadataList fetches a list of metadata items.
+func (c *PlexClient) metadataList(path string, params url.Values) ([]metadata, error) {
+	var result container
+	if err := c.get(path, params, &result); err != nil {
+		return nil, err
+	}
+	return result.MediaContainer.Metadata, nil
+}
+
+func (c *PlexClient) Playlists() ([]playlist.PlaylistInfo, error) {
+	items, err := c.metadataList("/playlists", url.Values{"playlistType": {"audio"}})
+	if err != nil {
+		return nil, err
+	}
+	var lists []playlist.PlaylistInfo
+	for _, m := range items {
+		lists = append(lists, playlist.PlaylistInfo{
+			ID:         m.RatingKey,
+			Name:       m.Title,
+			TrackCount: m.LeafCount,
+		})
+	}
+	return lists, nil
+}
+
+func (c *PlexClient) Tracks(id string) ([]playlist.Track, error) {
+	items, err := c.metadataList("/playlists/"+id+"/items", nil)
+	if err != nil {
+		return nil, err
+	}
+	var tracks []playlist.Track
+	for _, m := range items {
+		if t, ok := c.track(m); ok {
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks, nil
+}
+
+// track converts a track's metadata into a playlist track streaming its
+// first media part. Items without a playable part are skipped.
+func (c *PlexClient) track(m metadata) (playlist.Track, bool) {
+	if len(m.Media) == 0 || len(m.Media[0].Part) == 0 {
+		return playlist.Track{}, false
+	}
+	c.mu.Lock()
+	if c.durations == nil {
+		c.durations = make(map[string]int)
+	}
+	c.durations[m.RatingKey] = m.Duration
+	c.mu.Unlock()
+
+	artist := m.GrandparentTitle
+	if m.OriginalTitle != "" {
+		artist = m.OriginalTitle
+	}
+	return playlist.Track{
+		Path:   c.partURL(m.Media[0].Part[0].Key),
+		Title:  m.Title,
+		Artist: artist,
+		Album:  m.ParentTitle,
+		ID:     m.RatingKey,
+		Rating: int(m.UserRating+1) / 2,
+	}, true
+}
+
+// StreamURLs implements playlist.Streamer. Part URLs are not derived from
+// the rating key, so the track's metadata is looked up.
+func (c *PlexClient) StreamURLs(id string) (path, fallback string, err error) {
+	items, err := c.metadataList("/library/metadata/"+id, nil)
+	if err != nil {
+		return "", "", err
+	}
+	for _, m := range items {
+		if t, ok := c.track(m); ok {
+			return t.Path, "", nil
+		}
+	}
+	return "", "", fmt.Errorf("plex: track %s has no playable media", id)
+}
+
+// partURL returns the authenticated URL of a media part, which serves the
+// original file.
+func (c *PlexClient) partURL(key string) string {
+	sep := "?"
+	if strings.Contains(key, "?") {
+		sep = "&"
+	}
+	return c.URL + key + sep + url.Values{"X-Plex-Token": {c.Token}}.Encode()
+}
+
+// Scrobble implements playlist.Scrobbler. A finished play marks the track
+// as played, raising its play count; starting a track is reported through
+// ReportPlayback instead.
+func (c *PlexClient) Scrobble(id string, at time.Time, submission bool) error {
+	if !submission {
+		return nil
+	}
+	return c.get("/:/scrobble", url.Values{
+		"identifier": {libraryIdentifier},
+		"key":        {id},
+	}, nil)
+}
+
+// ReportPlayback implements playlist.PlaybackReporter with timeline
+// updates, which show the track in the server's dashboard until it is
+// reported as stopped.
+func (c *PlexClient) ReportPlayback(id, state string, position time.Duration) error {
+	c.mu.Lock()
+	duration := c.durations[id]
+	c.mu.Unlock()
+	return c.get("/:/timeline", url.Values{
+		"ratingKey": {id},
+		"key":       {"/library/metadata/" + id},
+		"state":     {state},
+		"time":      {strconv.FormatInt(position.Milliseconds(), 10)},
+		"duration":  {strconv.Itoa(duration)},
+	}, nil)
+}
+
+// SetStarred implements playlist.Rater. Plex has no favorites, only
+// ratings.
+func (c *PlexClient) SetStarred(id string, starred bool) error {
+	return errors.New("plex: favorites are not supported, rate the track instead")
+}
+
+// SetRating implements playlist.Rater using /:/rate, which takes ratings
+// of 0-10 and -1 to remove one.
+func (c *PlexClient) SetRating(id string, rating int) error {
+	r := -1
+	if rating > 0 {
+		r = rating * 2
+	}
+	return c.get("/:/rate", url.Values{
+		"identifier": {libraryIdentifier},
+		"key":        {id},
+		"rating":     {strconv.Itoa(r)},
+	}, nil)
+}
@@ -0,0 +1,236 @@
+package plex
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cliamp/playlist"
+)
+
+// fakeServer is a stand-in for the parts of the Plex API the client uses.
+// It accepts the token "tok" and records the query of every request.
+type fakeServer struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	requests []string // path?query of each request
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *PlexClient) {
+	f := &fakeServer{t: t}
+	srv := httptest.NewServer(f.handler())
+	t.Cleanup(srv.Close)
+	return f, &PlexClient{URL: srv.URL, Token: "tok"}
+}
+
+// albumTrack returns the metadata of a track with a media part.
+func albumTrack(key, title string, rating float64) map[string]any {
+	return map[string]any{
+		"ratingKey": key, "type": "track", "title": title,
+		"grandparentTitle": "Band", "parentTitle": "Record",
+		"duration": 61000, "userRating": rating,
+		"Media": []any{map[string]any{"Part": []any{map[string]any{"key": "/library/parts/" + key + "/file.flac"}}}},
+	}
+}
+
+func (f *fakeServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /library/sections", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeContainer(w, map[string]any{"Directory": []any{
+			map[string]any{"key": "1", "type": "artist", "title": "Music"},
+			map[string]any{"key": "2", "type": "movie", "title": "Films"},
+		}})
+	}))
+	mux.HandleFunc("GET /library/sections/1/all", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeContainer(w, map[string]any{"Metadata": []any{
+			map[string]any{"ratingKey": "9", "type": "album", "title": "Record", "parentTitle": "Band", "year": 1999, "leafCount": 2},
+		}})
+	}))
+	mux.HandleFunc("GET /playlists", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("playlistType") != "audio" {
+			f.t.Errorf("playlistType = %q", r.URL.Query().Get("playlistType"))
+		}
+		writeContainer(w, map[string]any{"Metadata": []any{
+			map[string]any{"ratingKey": "p1", "title": "Mix", "leafCount": 2},
+		}})
+	}))
+	mux.HandleFunc("GET /playlists/p1/items", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeContainer(w, map[string]any{"Metadata": []any{
+			albumTrack("41", "One", 8),
+			map[string]any{"ratingKey": "42", "type": "track", "title": "No media"},
+		}})
+	}))
+	mux.HandleFunc("GET /library/metadata/41", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeContainer(w, map[string]any{"Metadata": []any{albumTrack("41", "One", 0)}})
+	}))
+	for _, path := range []string{"/:/scrobble", "/:/timeline", "/:/rate"} {
+		mux.HandleFunc("GET "+path, f.authorized(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+	return mux
+}
+
+// authorized rejects requests without the token and records the others.
+func (f *fakeServer) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Plex-Token") != "tok" {
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("X-Plex-Client-Identifier"), "cliamp") {
+			f.t.Errorf("X-Plex-Client-Identifier = %q", r.Header.Get("X-Plex-Client-Identifier"))
+		}
+		f.mu.Lock()
+		f.requests = append(f.requests, r.URL.Path+"?"+r.URL.RawQuery)
+		f.mu.Unlock()
+		h(w, r)
+	}
+}
+
+func (f *fakeServer) take() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reqs := f.requests
+	f.requests = nil
+	return reqs
+}
+
+func writeContainer(w http.ResponseWriter, mc map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"MediaContainer": mc})
+}
+
+func TestInvalidToken(t *testing.T) {
+	_, c := newFakeServer(t)
+	c.Token = "bad"
+	if _, err := c.Browse(""); err == nil || err.Error() != "plex: invalid token" {
+		t.Errorf("err = %v, want invalid token", err)
+	}
+}
+
+func TestPlaylists(t *testing.T) {
+	_, c := newFakeServer(t)
+	lists, err := c.Playlists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []playlist.PlaylistInfo{{ID: "p1", Name: "Mix", TrackCount: 2}}; !reflect.DeepEqual(lists, want) {
+		t.Errorf("Playlists = %+v, want %+v", lists, want)
+	}
+
+	tracks, err := c.Tracks("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []playlist.Track{{
+		Path:   c.URL + "/library/parts/41/file.flac?X-Plex-Token=tok",
+		Title:  "One",
+		Artist: "Band",
+		Album:  "Record",
+		ID:     "41",
+		Rating: 4,
+	}}
+	if !reflect.DeepEqual(tracks, want) {
+		t.Errorf("Tracks = %+v, want %+v", tracks, want)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	_, c := newFakeServer(t)
+	tests := []struct {
+		id   string
+		want []playlist.Entry
+	}{
+		{"", []playlist.Entry{
+			{ID: "playlists", Name: "Playlists"},
+			{ID: "section:1", Name: "Music", Info: "library"},
+		}},
+		{"section:1", []playlist.Entry{
+			{ID: "artists:1", Name: "Artists"},
+			{ID: "albums:1", Name: "Albums"},
+			{ID: "recent:1", Name: "Recently Added"},
+		}},
+		{"albums:1", []playlist.Entry{{ID: "album:9", Name: "Band - Record", Info: "1999, 2 tracks"}}},
+		{"playlists", []playlist.Entry{{ID: "playlist:p1", Name: "Mix", Info: "2 tracks"}}},
+	}
+	for _, tt := range tests {
+		got, err := c.Browse(tt.id)
+		if err != nil {
+			t.Errorf("Browse(%q): %v", tt.id, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Browse(%q) = %+v, want %+v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestStreamURLs(t *testing.T) {
+	_, c := newFakeServer(t)
+	path, fallback, err := c.StreamURLs("41")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := c.URL + "/library/parts/41/file.flac?X-Plex-Token=tok"; path != want || fallback != "" {
+		t.Errorf("StreamURLs = %q, %q, want %q", path, fallback, want)
+	}
+}
+
+func TestReports(t *testing.T) {
+	f, c := newFakeServer(t)
+	// Looking the track up records its duration for timeline reports
+	if _, _, err := c.StreamURLs("41"); err != nil {
+		t.Fatal(err)
+	}
+	f.take()
+
+	tests := []struct {
+		name string
+		call func() error
+		want []string
+	}{
+		{
+			"now playing",
+			func() error { return c.Scrobble("41", time.Now(), false) },
+			nil,
+		},
+		{
+			"scrobble",
+			func() error { return c.Scrobble("41", time.Now(), true) },
+			[]string{"/:/scrobble?identifier=com.plexapp.plugins.library&key=41"},
+		},
+		{
+			"playing",
+			func() error { return c.ReportPlayback("41", "playing", 12500*time.Millisecond) },
+			[]string{"/:/timeline?duration=61000&key=%2Flibrary%2Fmetadata%2F41&ratingKey=41&state=playing&time=12500"},
+		},
+		{
+			"stopped",
+			func() error { return c.ReportPlayback("41", "stopped", time.Minute) },
+			[]string{"/:/timeline?duration=61000&key=%2Flibrary%2Fmetadata%2F41&ratingKey=41&state=stopped&time=60000"},
+		},
+		{
+			"rate",
+			func() error { return c.SetRating("41", 3) },
+			[]string{"/:/rate?identifier=com.plexapp.plugins.library&key=41&rating=6"},
+		},
+		{
+			"unrate",
+			func() error { return c.SetRating("41", 0) },
+			[]string{"/:/rate?identifier=com.plexapp.plugins.library&key=41&rating=-1"},
+		},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if got := f.take(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: requests = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
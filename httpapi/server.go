@@ -0,0 +1,378 @@
+// Package httpapi serves a REST/JSON remote control API, a server-sent
+// events stream of state changes and a small embedded web remote. All
+// requests are translated into ipc commands and executed by the same
+// handler as the control socket.
+//
+// Requests that change state must be sent as application/json, which web
+// pages on other origins cannot do without the server's consent, and may
+// be required to carry a bearer token.
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cliamp/ipc"
+	"cliamp/player"
+)
+
+// pollInterval is how often the player is sampled for the event stream.
+const pollInterval = 500 * time.Millisecond
+
+//go:embed index.html
+var indexHTML []byte
+
+// Server is the HTTP remote control server.
+type Server struct {
+	srv     *http.Server
+	handler ipc.Handler
+	token   string // required bearer token, "" for none
+	done    chan struct{}
+
+	mu     sync.Mutex
+	last   []byte                   // latest status JSON
+	subs   map[chan []byte]struct{} // event stream subscribers
+	closed bool
+}
+
+// Start listens on addr and serves the API in the background. If token is
+// set, API requests must carry it as a bearer token.
+func Start(addr, token string, h ipc.Handler) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		handler: h,
+		token:   token,
+		done:    make(chan struct{}),
+		subs:    make(map[chan []byte]struct{}),
+	}
+
+	s.srv = &http.Server{Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+	go s.srv.Serve(ln)
+	go s.watch()
+	return s, nil
+}
+
+// routes returns the handler serving the web remote and the API.
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/events", s.handleEvents)
+	mux.HandleFunc("POST /api/play", s.handlePlay)
+	mux.HandleFunc("POST /api/pause", s.command("pause"))
+	mux.HandleFunc("POST /api/toggle", s.command("toggle"))
+	mux.HandleFunc("POST /api/stop", s.command("stop"))
+	mux.HandleFunc("POST /api/next", s.command("next"))
+	mux.HandleFunc("POST /api/prev", s.command("prev"))
+	mux.HandleFunc("POST /api/seek", s.handleSeek)
+	mux.HandleFunc("PUT /api/volume", s.handleVolume)
+	mux.HandleFunc("GET /api/eq", s.handleEQStatus)
+	mux.HandleFunc("PUT /api/eq", s.handleEQ)
+	mux.HandleFunc("GET /api/playlist", s.handlePlaylist)
+	mux.HandleFunc("POST /api/queue", s.handleQueue)
+	mux.HandleFunc("DELETE /api/queue/{track}", s.handleDequeue)
+	return s.guard(mux)
+}
+
+// Close shuts the server down and ends all event streams.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+// guard checks the token of API requests and that requests changing state
+// are JSON, so that web pages on other sites cannot send them as forms.
+func (s *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.token != "" && !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cliamp"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mt != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, errors.New("Content-Type must be application/json"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether r carries the token, as a bearer token or,
+// for EventSource clients that cannot set headers, a "token" parameter.
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// exec runs a command and writes its response as JSON.
+func (s *Server) exec(w http.ResponseWriter, req ipc.Request) {
+	resp := s.handler(req)
+	if !resp.OK {
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// command returns a handler for a command without arguments.
+func (s *Server) command(cmd string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.exec(w, ipc.Request{Cmd: cmd})
+	}
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.exec(w, ipc.Request{Cmd: "status"})
+}
+
+func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	s.exec(w, ipc.Request{Cmd: "list"})
+}
+
+// handlePlay resumes playback, or plays {"track": N} (1-based).
+func (s *Server) handlePlay(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Track int `json:"track"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	req := ipc.Request{Cmd: "play"}
+	if body.Track > 0 {
+		req.Args = []string{strconv.Itoa(body.Track)}
+	}
+	s.exec(w, req)
+}
+
+// handleSeek accepts {"position": SECONDS} or {"offset": SECONDS}.
+func (s *Server) handleSeek(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Position *float64 `json:"position"`
+		Offset   *float64 `json:"offset"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	switch {
+	case body.Position != nil:
+		s.exec(w, ipc.Request{Cmd: "seek", Args: []string{fmt.Sprintf("=%g", *body.Position)}})
+	case body.Offset != nil:
+		s.exec(w, ipc.Request{Cmd: "seek", Args: []string{fmt.Sprintf("%+g", *body.Offset)}})
+	default:
+		writeError(w, http.StatusBadRequest, errors.New(`want "position" or "offset"`))
+	}
+}
+
+// handleVolume accepts {"volume": DB}.
+func (s *Server) handleVolume(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Volume *float64 `json:"volume"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Volume == nil {
+		writeError(w, http.StatusBadRequest, errors.New(`want "volume"`))
+		return
+	}
+	s.exec(w, ipc.Request{Cmd: "volume", Args: []string{fmt.Sprintf("=%g", *body.Volume)}})
+}
+
+// handleEQStatus returns the status along with the names of the EQ
+// presets, so that clients need not keep their own list.
+func (s *Server) handleEQStatus(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		ipc.Response
+		Presets []string `json:"presets"`
+	}{s.handler(ipc.Request{Cmd: "status"}), player.EQPresetNames()}
+	code := http.StatusOK
+	if !resp.OK {
+		code = http.StatusBadRequest
+	}
+	writeJSON(w, code, resp)
+}
+
+// handleEQ accepts {"preset": NAME} or {"bands": [10 gains]}.
+func (s *Server) handleEQ(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Preset string    `json:"preset"`
+		Bands  []float64 `json:"bands"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	req := ipc.Request{Cmd: "eq"}
+	if body.Preset != "" {
+		req.Args = []string{"preset", body.Preset}
+	} else {
+		for _, g := range body.Bands {
+			req.Args = append(req.Args, strconv.FormatFloat(g, 'f', -1, 64))
+		}
+	}
+	s.exec(w, req)
+}
+
+// handleQueue accepts {"track": N} to queue a playlist track or
+// {"path": PATH} to add a file or URL and queue it. Paths are only taken
+// with a token set, since the player opens whatever it is given.
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Track int    `json:"track"`
+		Path  string `json:"path"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	switch {
+	case body.Track > 0:
+		s.exec(w, ipc.Request{Cmd: "queue", Args: []string{strconv.Itoa(body.Track)}})
+	case body.Path != "" && s.token == "":
+		writeError(w, http.StatusForbidden, errors.New(`"path" requires http_token to be set; queue playlist tracks by "track"`))
+	case body.Path != "":
+		s.exec(w, ipc.Request{Cmd: "queue", Args: []string{body.Path}})
+	default:
+		writeError(w, http.StatusBadRequest, errors.New(`want "track" or "path"`))
+	}
+}
+
+func (s *Server) handleDequeue(w http.ResponseWriter, r *http.Request) {
+	s.exec(w, ipc.Request{Cmd: "dequeue", Args: []string{r.PathValue("track")}})
+}
+
+// handleEvents streams status snapshots as server-sent events whenever
+// the player state changes.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ch := make(chan []byte, 4)
+	s.mu.Lock()
+	s.subs[ch] = struct{}{}
+	last := s.last
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+	}()
+
+	if last != nil {
+		writeEvent(w, last)
+		flusher.Flush()
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case data := <-ch:
+			writeEvent(w, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// watch polls the player and fans changed statuses out to subscribers.
+func (s *Server) watch() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		resp := s.handler(ipc.Request{Cmd: "status"})
+		if resp.Status == nil {
+			continue
+		}
+		data, err := json.Marshal(resp.Status)
+		if err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		if !bytes.Equal(data, s.last) {
+			s.last = data
+			for ch := range s.subs {
+				select {
+				case ch <- data:
+				default: // slow client; it will catch up on the next change
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, data []byte) {
+	fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+}
+
+// readJSON decodes an optional JSON request body into v.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, ipc.Response{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"cliamp/ipc"
+	"cliamp/player"
+)
+
+// recorder is an ipc.Handler that records the requests it is given.
+type recorder struct {
+	mu   sync.Mutex
+	reqs []ipc.Request
+}
+
+func (r *recorder) handle(req ipc.Request) ipc.Response {
+	r.mu.Lock()
+	r.reqs = append(r.reqs, req)
+	r.mu.Unlock()
+	return ipc.Response{OK: true, Status: &ipc.Status{State: "stopped", Index: -1}}
+}
+
+func newTestServer(t *testing.T, token string) (*recorder, *httptest.Server) {
+	rec := &recorder{}
+	s := &Server{handler: rec.handle, token: token, done: make(chan struct{}), subs: make(map[chan []byte]struct{})}
+	srv := httptest.NewServer(s.routes())
+	t.Cleanup(srv.Close)
+	return rec, srv
+}
+
+func TestGuard(t *testing.T) {
+	const jsonType = "application/json"
+	tests := []struct {
+		name        string
+		token       string
+		method      string
+		path        string
+		contentType string
+		auth        string
+		body        string
+		wantCode    int
+		wantCmd     *ipc.Request
+	}{
+		{name: "index", method: "GET", path: "/", token: "secret", wantCode: 200},
+		{name: "status", method: "GET", path: "/api/status", wantCode: 200, wantCmd: &ipc.Request{Cmd: "status"}},
+		{name: "json post", method: "POST", path: "/api/next", contentType: jsonType, wantCode: 200, wantCmd: &ipc.Request{Cmd: "next"}},
+		{name: "json with charset", method: "PUT", path: "/api/volume", contentType: "application/json; charset=utf-8", body: `{"volume": -3}`, wantCode: 200, wantCmd: &ipc.Request{Cmd: "volume", Args: []string{"=-3"}}},
+		{name: "form post", method: "POST", path: "/api/next", contentType: "application/x-www-form-urlencoded", wantCode: 415},
+		{name: "text post", method: "POST", path: "/api/play", contentType: "text/plain", body: `{"track": 1}`, wantCode: 415},
+		{name: "no content type", method: "POST", path: "/api/stop", wantCode: 415},
+		{name: "missing token", token: "secret", method: "GET", path: "/api/status", wantCode: 401},
+		{name: "wrong token", token: "secret", method: "GET", path: "/api/status", auth: "Bearer nope", wantCode: 401},
+		{name: "bearer token", token: "secret", method: "GET", path: "/api/status", auth: "Bearer secret", wantCode: 200, wantCmd: &ipc.Request{Cmd: "status"}},
+		{name: "query token", token: "secret", method: "GET", path: "/api/status?token=secret", wantCode: 200, wantCmd: &ipc.Request{Cmd: "status"}},
+		{name: "token before content type", token: "secret", method: "POST", path: "/api/next", wantCode: 401},
+		{name: "queue track", method: "POST", path: "/api/queue", contentType: jsonType, body: `{"track": 2}`, wantCode: 200, wantCmd: &ipc.Request{Cmd: "queue", Args: []string{"2"}}},
+		{name: "queue path without token", method: "POST", path: "/api/queue", contentType: jsonType, body: `{"path": "/etc/passwd"}`, wantCode: 403},
+		{name: "queue path with token", token: "secret", method: "POST", path: "/api/queue", contentType: jsonType, auth: "Bearer secret", body: `{"path": "/music/a.mp3"}`, wantCode: 200, wantCmd: &ipc.Request{Cmd: "queue", Args: []string{"/music/a.mp3"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, srv := newTestServer(t, tt.token)
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", resp.StatusCode, tt.wantCode, body)
+			}
+			if tt.wantCode == 401 && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+			var want []ipc.Request
+			if tt.wantCmd != nil {
+				want = []ipc.Request{*tt.wantCmd}
+			}
+			if !reflect.DeepEqual(rec.reqs, want) {
+				t.Errorf("requests = %+v, want %+v", rec.reqs, want)
+			}
+		})
+	}
+}
+
+func TestEQStatusListsPresets(t *testing.T) {
+	_, srv := newTestServer(t, "")
+	resp, err := http.Get(srv.URL + "/api/eq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		OK      bool        `json:"ok"`
+		Status  *ipc.Status `json:"status"`
+		Presets []string    `json:"presets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.OK || body.Status == nil {
+		t.Errorf("response = %+v, want the status", body)
+	}
+	if !reflect.DeepEqual(body.Presets, player.EQPresetNames()) {
+		t.Errorf("presets = %q, want %q", body.Presets, player.EQPresetNames())
+	}
+}
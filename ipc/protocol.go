@@ -0,0 +1,76 @@
+// Package ipc implements the control socket used to drive a running cliamp
+// instance. The protocol is line-delimited JSON over a Unix domain socket:
+// each line sent by the client is a Request and the server answers with
+// exactly one Response line.
+package ipc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Request is a single command sent to the player.
+type Request struct {
+	Cmd  string   `json:"cmd"`
+	Args []string `json:"args,omitempty"`
+}
+
+// Response is the reply to a Request. Status reflects the player state
+// after the command has been applied.
+type Response struct {
+	OK       bool        `json:"ok"`
+	Error    string      `json:"error,omitempty"`
+	Status   *Status     `json:"status,omitempty"`
+	Playlist []TrackInfo `json:"playlist,omitempty"` // filled by the "list" command
+}
+
+// Status is a snapshot of the player and playlist state.
+type Status struct {
+	State    string    `json:"state"` // "playing", "paused" or "stopped"
+	Track    TrackInfo `json:"track"`
+	Index    int       `json:"index"`    // 0-based track index, -1 if none
+	Position float64   `json:"position"` // seconds
+	Duration float64   `json:"duration"` // seconds
+	Volume   float64   `json:"volume"`   // dB
+	Repeat   string    `json:"repeat"`
+	Shuffle  bool      `json:"shuffle"`
+	Tracks   int       `json:"tracks"`
+	Queue    int       `json:"queue"`
+	Sleep    string    `json:"sleep,omitempty"`
+	Loop     *Loop     `json:"loop,omitempty"` // A-B loop, nil if no point is set
+	EQ       []float64 `json:"eq"`             // 10 band gains in dB
+	EQPreset string    `json:"eq_preset"`
+	Err      string    `json:"last_error,omitempty"` // most recent player error
+}
+
+// Loop is an A-B loop within the current track.
+type Loop struct {
+	A      float64 `json:"a"` // seconds
+	B      float64 `json:"b"` // seconds, valid once active
+	Active bool    `json:"active"`
+}
+
+// TrackInfo describes a playlist track.
+type TrackInfo struct {
+	Path    string `json:"path"` // file path or URL; "Provider:ID" for provider tracks
+	Title   string `json:"title"`
+	Artist  string `json:"artist,omitempty"`
+	Album   string `json:"album,omitempty"`
+	Queued  int    `json:"queued,omitempty"` // 1-based queue position, 0 if not queued
+	Starred bool   `json:"starred,omitempty"`
+	Rating  int    `json:"rating,omitempty"` // 1-5, 0 if unrated
+}
+
+// Handler executes a request and returns its response.
+type Handler func(Request) Response
+
+// SocketPath returns the default control socket location:
+// $XDG_RUNTIME_DIR/cliamp.sock, falling back to a private per-user
+// directory in the system temp directory.
+func SocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "cliamp.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("cliamp-%d", os.Getuid()), "cliamp.sock")
+}
@@ -0,0 +1,108 @@
+package ipc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// maxRequestSize bounds a single request line, which may carry many paths.
+const maxRequestSize = 4 << 20
+
+// Server accepts control connections on a Unix domain socket.
+type Server struct {
+	ln      net.Listener
+	path    string
+	handler Handler
+	wg      sync.WaitGroup
+}
+
+// Listen creates the control socket at path and starts serving requests
+// with h. A stale socket left behind by a crashed instance is replaced,
+// but Listen fails if another instance is still answering on path.
+//
+// The socket's directory is created if needed and must not be accessible
+// by other users, so that no one else can connect before the socket's own
+// permissions are tightened.
+func Listen(path string, h Handler) (*Server, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("%s is accessible by other users (mode %v); use a private directory for the socket", dir, fi.Mode().Perm())
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another instance is listening on %s", path)
+		}
+		os.Remove(path)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	s := &Server{ln: ln, path: path, handler: h}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting connections and removes the socket file.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle answers each request line on conn until the client disconnects.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRequestSize)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req Request
+		var resp Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = Response{Error: fmt.Sprintf("invalid request: %s", err)}
+		} else {
+			resp = s.handler(req)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
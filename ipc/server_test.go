@@ -0,0 +1,152 @@
+package ipc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// echo answers every request with its command as the track title, and
+// fails "boom".
+func echo(req Request) Response {
+	if req.Cmd == "boom" {
+		return Response{Error: "it broke"}
+	}
+	return Response{OK: true, Status: &Status{Track: TrackInfo{Title: req.Cmd + " " + strings.Join(req.Args, " ")}}}
+}
+
+// sockPath returns a socket path in a private temporary directory.
+func sockPath(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "cliamp.sock")
+}
+
+func listen(t *testing.T, path string) *Server {
+	t.Helper()
+	s, err := Listen(path, echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := sockPath(t)
+	listen(t, path)
+
+	tests := []struct {
+		req     Request
+		want    string
+		wantErr string
+	}{
+		{req: Request{Cmd: "play", Args: []string{"2"}}, want: "play 2"},
+		{req: Request{Cmd: "add", Args: []string{"/music/a b.mp3"}}, want: "add /music/a b.mp3"},
+		{req: Request{Cmd: "boom"}, wantErr: "it broke"},
+	}
+	for _, tt := range tests {
+		resp, err := Send(path, tt.req)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: err = %v, want %q", tt.req.Cmd, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.req.Cmd, err)
+			continue
+		}
+		if resp.Status == nil || resp.Status.Track.Title != tt.want {
+			t.Errorf("%s: response %+v, want title %q", tt.req.Cmd, resp, tt.want)
+		}
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket mode %v, want 0600", perm)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := sockPath(t)
+	// A crashed instance leaves its socket file behind
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("stale socket missing: %v", err)
+	}
+
+	listen(t, path)
+	if _, err := Send(path, Request{Cmd: "status"}); err != nil {
+		t.Errorf("Send: %v", err)
+	}
+}
+
+func TestListenAlreadyRunning(t *testing.T) {
+	path := sockPath(t)
+	listen(t, path)
+
+	if s, err := Listen(path, echo); err == nil {
+		s.Close()
+		t.Fatal("second Listen succeeded")
+	} else if !strings.Contains(err.Error(), "another instance is listening") {
+		t.Errorf("err = %v", err)
+	}
+	// The running instance keeps its socket
+	if _, err := Send(path, Request{Cmd: "status"}); err != nil {
+		t.Errorf("Send after refused Listen: %v", err)
+	}
+}
+
+func TestListenDirectory(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    os.FileMode // of an existing directory, 0 to let Listen create it
+		wantErr bool
+	}{
+		{name: "created"},
+		{name: "private", mode: 0o700},
+		{name: "shared", mode: 0o777, wantErr: true},
+		{name: "group readable", mode: 0o750, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(filepath.Dir(sockPath(t)), "cliamp-1000")
+			if tt.mode != 0 {
+				if err := os.Mkdir(dir, 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chmod(dir, tt.mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s, err := Listen(filepath.Join(dir, "cliamp.sock"), echo)
+			if err == nil {
+				s.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			fi, err := os.Stat(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := fi.Mode().Perm(); !tt.wantErr && perm != 0o700 {
+				t.Errorf("directory mode %v, want 0700", perm)
+			}
+		})
+	}
+}
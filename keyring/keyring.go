@@ -0,0 +1,121 @@
+//go:build linux
+
+// Package keyring reads secrets from the desktop keyring through the
+// freedesktop Secret Service D-Bus API, as provided by GNOME Keyring,
+// KeePassXC and KWallet.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	serviceName  = "org.freedesktop.secrets"
+	servicePath  = dbus.ObjectPath("/org/freedesktop/secrets")
+	serviceIface = "org.freedesktop.Secret.Service"
+	itemIface    = "org.freedesktop.Secret.Item"
+	sessionIface = "org.freedesktop.Secret.Session"
+	promptIface  = "org.freedesktop.Secret.Prompt"
+
+	// promptTimeout bounds how long we wait for the user to unlock the
+	// keyring.
+	promptTimeout = 2 * time.Minute
+)
+
+// ErrNotFound is returned when no item matches the attributes.
+var ErrNotFound = errors.New("keyring: no matching secret")
+
+// secret is the Secret Service (oayays) secret struct.
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// Lookup returns the secret of the first keyring item whose attributes
+// include attrs, unlocking the keyring if necessary.
+func Lookup(attrs map[string]string) (string, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return "", fmt.Errorf("keyring: %w", err)
+	}
+	defer conn.Close()
+	svc := conn.Object(serviceName, servicePath)
+
+	var unlocked, locked []dbus.ObjectPath
+	if err := svc.Call(serviceIface+".SearchItems", 0, attrs).Store(&unlocked, &locked); err != nil {
+		return "", fmt.Errorf("keyring: %w", err)
+	}
+	if len(unlocked) == 0 && len(locked) > 0 {
+		if unlocked, err = unlock(conn, svc, locked[:1]); err != nil {
+			return "", err
+		}
+	}
+	if len(unlocked) == 0 {
+		return "", ErrNotFound
+	}
+
+	// The plain algorithm transfers the secret unencrypted, which is fine
+	// over the private session bus.
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	if err := svc.Call(serviceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session); err != nil {
+		return "", fmt.Errorf("keyring: %w", err)
+	}
+	defer conn.Object(serviceName, session).Call(sessionIface+".Close", 0)
+
+	var s secret
+	if err := conn.Object(serviceName, unlocked[0]).Call(itemIface+".GetSecret", 0, session).Store(&s); err != nil {
+		return "", fmt.Errorf("keyring: %w", err)
+	}
+	return string(s.Value), nil
+}
+
+// unlock unlocks items, showing the keyring's unlock prompt if needed.
+func unlock(conn *dbus.Conn, svc dbus.BusObject, items []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := svc.Call(serviceIface+".Unlock", 0, items).Store(&unlocked, &prompt); err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	if prompt == "/" {
+		return unlocked, nil
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(promptIface),
+		dbus.WithMatchMember("Completed"),
+	); err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 1)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	if err := conn.Object(serviceName, prompt).Call(promptIface+".Prompt", 0, "").Err; err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	timeout := time.After(promptTimeout)
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != prompt || len(sig.Body) < 2 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return nil, errors.New("keyring: unlock was dismissed")
+			}
+			result, _ := sig.Body[1].(dbus.Variant)
+			paths, _ := result.Value().([]dbus.ObjectPath)
+			return paths, nil
+		case <-timeout:
+			return nil, errors.New("keyring: timed out waiting for the keyring to be unlocked")
+		}
+	}
+}
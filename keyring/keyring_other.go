@@ -0,0 +1,13 @@
+//go:build !linux
+
+package keyring
+
+import "errors"
+
+// ErrNotFound is returned when no item matches the attributes.
+var ErrNotFound = errors.New("keyring: no matching secret")
+
+// Lookup is unavailable on platforms without a D-Bus session bus.
+func Lookup(attrs map[string]string) (string, error) {
+	return "", errors.New("keyring: the Secret Service is only supported on Linux")
+}
@@ -3,20 +3,28 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/gopxl/beep/v2"
 
+	"cliamp/bookmark"
 	"cliamp/config"
-	"cliamp/external/navidrome"
+	"cliamp/httpapi"
+	"cliamp/ipc"
+	"cliamp/mpd"
+	"cliamp/mpris"
 	"cliamp/player"
 	"cliamp/playlist"
+	"cliamp/scrobble"
+	"cliamp/session"
 	"cliamp/ui"
 )
 
@@ -34,50 +42,213 @@ var audioExts = map[string]bool{
 	".opus": true,
 }
 
-func run() error {
-	var provider playlist.Provider
+// run dispatches to the command named by the first argument, playing the
+// arguments if there is none.
+func run(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "play":
+			return runPlay(args[1:])
+		case "scan":
+			return runScan(args[1:])
+		case "ctl":
+			return runCtl(args[1:])
+		case "attach":
+			return runAttach(args[1:])
+		case "config":
+			return runConfig(args[1:])
+		case "help", "-h", "--help":
+			return runHelp(args[1:])
+		case "version":
+			fmt.Println(versionString())
+			return nil
+		}
+	}
+	return runPlay(args)
+}
+
+// playFlags are the play command's options.
+type playFlags struct {
+	config   string
+	noTUI    bool
+	resume   bool
+	version  bool
+	volume   float64
+	shuffle  bool
+	repeat   string
+	eqPreset string
+	startAt  string
+	sleep    string
+}
+
+// playCommand returns the play command, for its help.
+func playCommand() *command {
+	c, _ := newPlayCommand()
+	return c
+}
 
-	navURL := os.Getenv("NAVIDROME_URL")
-	navUser := os.Getenv("NAVIDROME_USER")
-	navPass := os.Getenv("NAVIDROME_PASS")
+// newPlayCommand returns the play command and the options its flags are
+// bound to.
+func newPlayCommand() (*command, *playFlags) {
+	c := newCommand("play", playUsage)
+	f := &playFlags{}
+	fs := c.flags
+	fs.StringVar(&f.config, "config", "", "read settings from `FILE` instead of the default config file")
+	fs.BoolVar(&f.noTUI, "no-tui", false, "play without a terminal, controlled by \"cliamp ctl\" (also --daemon)")
+	fs.BoolVar(&f.noTUI, "daemon", false, "same as --no-tui")
+	fs.BoolVar(&f.noTUI, "headless", false, "same as --no-tui")
+	c.hidden["daemon"], c.hidden["headless"] = true, true
+	fs.BoolVar(&f.resume, "resume", false, "restore the last session even when files are given")
+	fs.Float64Var(&f.volume, "volume", 0, "volume in `dB`, from -30 to 6")
+	fs.BoolVar(&f.shuffle, "shuffle", false, "shuffle the playlist (--shuffle=false turns it off)")
+	fs.StringVar(&f.repeat, "repeat", "", "repeat `MODE`: off, all or one")
+	fs.StringVar(&f.eqPreset, "eq-preset", "", "EQ preset `NAME`, e.g. Rock, or Custom for the config's bands")
+	fs.StringVar(&f.startAt, "start-at", "", "start the first (or restored) track at `POS`: seconds, MM:SS or 1m30s")
+	fs.StringVar(&f.sleep, "sleep", "", "arm the sleep timer: `MINUTES`, a duration such as 1h30m, track or album")
+	fs.BoolVar(&f.version, "version", false, "print the version and exit")
+	return c, f
+}
+
+// loadConfig loads the config file at path, or the default one if path is
+// "", returning the path it used. A file given explicitly must exist.
+func loadConfig(path string) (config.Config, string, []string, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return config.Config{}, path, nil, fmt.Errorf("config: %w", err)
+		}
+	} else {
+		var err error
+		if path, err = config.Path(); err != nil {
+			return config.Config{}, path, nil, fmt.Errorf("config: %w", err)
+		}
+	}
+	cfg, warnings, err := config.Load(path)
+	if err != nil {
+		return cfg, path, warnings, fmt.Errorf("config: %w", err)
+	}
+	return cfg, path, warnings, nil
+}
 
-	if navURL != "" && navUser != "" && navPass != "" {
-		provider = &navidrome.NavidromeClient{URL: navURL, User: navUser, Password: navPass}
+// applyPlayOrder sets the playlist's repeat mode and shuffle from cfg. A
+// restored session keeps the shuffle order it was saved with unless
+// --shuffle was given.
+func applyPlayOrder(pl *playlist.Playlist, cfg config.Config, restored, shuffleFlag bool) {
+	switch cfg.Repeat {
+	case "all":
+		pl.CycleRepeat() // off -> all
+	case "one":
+		pl.CycleRepeat() // off -> all
+		pl.CycleRepeat() // all -> one
 	}
+	if (!restored || shuffleFlag) && cfg.Shuffle != pl.Shuffled() {
+		pl.ToggleShuffle()
+	}
+}
 
-	if len(os.Args) < 2 && provider == nil {
-		return errors.New("usage: cliamp <file|folder> [...] or configure a provider via ENV\n\n - Navidrome: NAVIDROME_URL, NAVIDROME_USER, NAVIDROME_PASS\n")
+// runPlay implements the play command, the default.
+func runPlay(argv []string) error {
+	c, f := newPlayCommand()
+	args, err := c.parse(argv)
+	if err != nil {
+		return err
 	}
+	if f.version {
+		fmt.Println(versionString())
+		return nil
+	}
+	set := c.set()
 
-	// Expand shell globs and resolve directories into audio files
-	var files []string
-	for _, arg := range os.Args[1:] {
-		matches, err := filepath.Glob(arg)
-		if err != nil || len(matches) == 0 {
-			matches = []string{arg}
+	// Validate the settings flags before anything is loaded
+	if set["volume"] && (f.volume < -30 || f.volume > 6) {
+		return usageError{"play", fmt.Sprintf("invalid value %v for --volume: must be between -30 and 6 dB", f.volume)}
+	}
+	var repeat config.RepeatMode
+	if set["repeat"] {
+		if err := repeat.UnmarshalText([]byte(f.repeat)); err != nil {
+			return usageError{"play", "--repeat: " + err.Error()}
 		}
-		for _, path := range matches {
-			resolved, err := collectAudioFiles(path)
-			if err != nil {
-				return fmt.Errorf("scanning %s: %w", path, err)
-			}
-			files = append(files, resolved...)
+	}
+	eqPreset, err := eqPresetName(f.eqPreset)
+	if err != nil {
+		return usageError{"play", "--eq-preset: " + err.Error()}
+	}
+	var startAt time.Duration
+	if set["start-at"] {
+		if startAt, err = parsePosition(f.startAt); err != nil {
+			return usageError{"play", "--start-at: " + err.Error()}
 		}
 	}
 
-	if len(files) == 0 && provider == nil {
+	// --no-tui runs without the TUI, controlled over the control socket,
+	// MPRIS, HTTP or MPD.
+	headless, resume := f.noTUI, f.resume
+
+	cfg, cfgPath, warnings, err := loadConfig(f.config)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "config: warning: %s\n", w)
+	}
+
+	// Flags override the config for this run; saved is what the file holds
+	saved := cfg.Settings()
+	if set["volume"] {
+		cfg.Volume = f.volume
+	}
+	if set["shuffle"] {
+		cfg.Shuffle = f.shuffle
+	}
+	if set["repeat"] {
+		cfg.Repeat = repeat
+	}
+	if set["eq-preset"] {
+		cfg.EQPreset = eqPreset
+	}
+
+	// Every configured provider is offered as a source in the library
+	// browser.
+	providers, err := buildProviders(cfg.Providers)
+	if err != nil {
+		return err
+	}
+
+	// Pick up the last session when started without files
+	var sess session.Session
+	if len(args) == 0 || resume {
+		if sess, err = session.Load(); err != nil {
+			return fmt.Errorf("session: %w", err)
+		}
+	}
+	restored := len(sess.Playlist.Tracks) > 0
+
+	if len(args) == 0 && len(providers) == 0 && !restored && !headless {
+		return usageError{"", "nothing to play: give files, folders or URLs, or configure a media server"}
+	}
+
+	// Expand globs and folders into absolute paths, so that a restored
+	// session does not depend on the working directory
+	files, err := resolvePaths(args)
+	if err != nil {
+		return err
+	}
+
+	// A daemon may start empty and receive tracks via `cliamp ctl add`
+	if len(files) == 0 && len(providers) == 0 && !restored && !headless {
 		return errors.New("no playable files found")
 	}
 
 	pl := playlist.New()
+	if restored {
+		pl.Restore(sess.Playlist)
+	}
 	for _, f := range files {
 		pl.Add(playlist.TrackFromPath(f))
 	}
 
-	// Load user config
-	cfg, err := config.Load()
+	bookmarks, err := bookmark.Load()
 	if err != nil {
-		return fmt.Errorf("config: %w", err)
+		return fmt.Errorf("bookmarks: %w", err)
 	}
 
 	// Initialize audio engine at CD-quality sample rate
@@ -87,32 +258,178 @@ func run() error {
 
 	// Apply config
 	p.SetVolume(cfg.Volume)
+	p.SetFadeTime(time.Duration(cfg.FadeMs) * time.Millisecond)
 	if cfg.EQPreset == "" || cfg.EQPreset == "Custom" {
 		for i, gain := range cfg.EQ {
 			p.SetEQBand(i, gain)
 		}
 	}
-	switch cfg.Repeat {
-	case "all":
-		pl.CycleRepeat() // off -> all
-	case "one":
-		pl.CycleRepeat() // off -> all
-		pl.CycleRepeat() // all -> one
+	applyPlayOrder(pl, cfg, restored, set["shuffle"])
+
+	var services []scrobble.Service
+	if cfg.ListenBrainzToken != "" {
+		services = append(services, &scrobble.ListenBrainz{URL: cfg.ListenBrainzURL, Token: cfg.ListenBrainzToken})
 	}
-	if cfg.Shuffle {
-		pl.ToggleShuffle()
+	if cfg.LastFMAPIKey != "" && cfg.LastFMSecret != "" {
+		services = append(services, &scrobble.LastFM{
+			URL:        cfg.LastFMURL,
+			APIKey:     cfg.LastFMAPIKey,
+			Secret:     cfg.LastFMSecret,
+			SessionKey: cfg.LastFMSessionKey,
+			Username:   cfg.LastFMUser,
+			Password:   cfg.LastFMPassword,
+		})
 	}
 
 	// Launch the TUI
-	m := ui.NewModel(p, pl, provider)
+	m := ui.NewModel(p, pl, providers)
+	m.SetBookmarks(bookmarks)
+	if restored || startAt > 0 {
+		pos := sess.Position
+		if set["start-at"] {
+			pos = startAt
+		}
+		m.Resume(pos)
+	}
+	if len(services) > 0 {
+		scrobbler, err := scrobble.Start(services...)
+		if err != nil {
+			return fmt.Errorf("scrobbler: %w", err)
+		}
+		defer scrobbler.Close()
+		m.SetScrobbler(scrobbler)
+	}
 	if cfg.EQPreset != "" && cfg.EQPreset != "Custom" {
 		m.SetEQPreset(cfg.EQPreset)
 	}
-	prog := tea.NewProgram(m, tea.WithAltScreen())
-	if _, err := prog.Run(); err != nil {
+	if set["sleep"] {
+		if err := m.SetSleep(f.sleep); err != nil {
+			return usageError{"play", "--sleep: " + err.Error()}
+		}
+	}
+	opts := []tea.ProgramOption{tea.WithAltScreen()}
+	if headless {
+		// Same update loop drives track advancement, with no terminal I/O
+		opts = []tea.ProgramOption{tea.WithoutRenderer(), tea.WithInput(nil)}
+	}
+	prog := tea.NewProgram(m, opts...)
+
+	// Unknown keys are usually typos; point them out without refusing to
+	// start, since the alternate screen hides what was printed above.
+	if len(warnings) > 0 {
+		msg := warnings[0]
+		if len(warnings) > 1 {
+			msg += fmt.Sprintf(" (and %d more)", len(warnings)-1)
+		}
+		go prog.Send(fmt.Errorf("config: %s", msg))
+	}
+
+	// Accept commands from `cliamp ctl` and scripts
+	srv, err := ipc.Listen(ipc.SocketPath(), ui.RemoteHandler(prog))
+	switch {
+	case err != nil && headless:
+		// A daemon without its control socket cannot be driven
+		return fmt.Errorf("control socket: %w", err)
+	case err != nil:
+		go prog.Send(fmt.Errorf("control socket: %w", err))
+	default:
+		defer srv.Close()
+	}
+
+	// Media keys and desktop integration via MPRIS
+	bus, err := mpris.Start(ui.RemoteHandler(prog))
+	if err != nil {
+		go prog.Send(fmt.Errorf("mpris: %w", err))
+	}
+	defer bus.Close()
+
+	// Optional HTTP remote and web UI
+	if cfg.HTTPAddr != "" {
+		web, err := httpapi.Start(cfg.HTTPAddr, cfg.HTTPToken, ui.RemoteHandler(prog))
+		if err != nil {
+			go prog.Send(fmt.Errorf("http: %w", err))
+		} else {
+			defer web.Close()
+		}
+	}
+
+	// Optional MPD protocol server for existing MPD clients
+	if cfg.MPDAddr != "" {
+		mpdSrv, err := mpd.Start(cfg.MPDAddr, ui.RemoteHandler(prog))
+		if err != nil {
+			go prog.Send(fmt.Errorf("mpd: %w", err))
+		} else {
+			defer mpdSrv.Close()
+		}
+	}
+
+	start := settings(p, pl, m)
+	final, err := prog.Run()
+	if err != nil && !(headless && errors.Is(err, tea.ErrInterrupted)) { // Ctrl+C stops the daemon
 		return fmt.Errorf("tui: %w", err)
 	}
 
+	// Keep volume, EQ, repeat and shuffle changes and the session for the
+	// next start
+	if m, ok := final.(ui.Model); ok {
+		if err := config.Save(cfgPath, changed(saved, start, settings(p, pl, m))); err != nil {
+			return fmt.Errorf("saving settings: %w", err)
+		}
+		if err := session.Save(session.Session{Playlist: pl.State(), Position: m.Position()}); err != nil {
+			return fmt.Errorf("saving session: %w", err)
+		}
+	}
+	return nil
+}
+
+// settings returns the current values of the settings stored in the
+// config file.
+func settings(p *player.Player, pl *playlist.Playlist, m ui.Model) config.Settings {
+	return config.Settings{
+		Volume:   p.Volume(),
+		EQ:       p.EQBands(),
+		EQPreset: m.EQPresetName(),
+		Repeat:   config.RepeatMode(strings.ToLower(pl.Repeat().String())),
+		Shuffle:  pl.Shuffled(),
+	}
+}
+
+// changed returns the settings to save at exit: the ones changed while
+// running, and the config file's values for the rest, so that flags only
+// apply to one run.
+func changed(saved, start, end config.Settings) config.Settings {
+	if end.Volume == start.Volume {
+		end.Volume = saved.Volume
+	}
+	if end.EQ == start.EQ && end.EQPreset == start.EQPreset {
+		end.EQ, end.EQPreset = saved.EQ, saved.EQPreset
+	}
+	if end.Repeat == start.Repeat {
+		end.Repeat = saved.Repeat
+	}
+	if end.Shuffle == start.Shuffle {
+		end.Shuffle = saved.Shuffle
+	}
+	return end
+}
+
+// runAttach implements the `cliamp attach` subcommand, opening a TUI on a
+// running instance such as a headless daemon.
+func runAttach(args []string) error {
+	if isHelp(args) {
+		fmt.Println(attachUsage)
+		return nil
+	}
+	if len(args) > 0 {
+		return usageError{"attach", fmt.Sprintf("unexpected argument %q", args[0])}
+	}
+	sock := ipc.SocketPath()
+	if _, err := ipc.Send(sock, ipc.Request{Cmd: "status"}); err != nil {
+		return fmt.Errorf("attach: %w", err)
+	}
+	if _, err := tea.NewProgram(ui.NewAttachModel(sock), tea.WithAltScreen()).Run(); err != nil {
+		return fmt.Errorf("tui: %w", err)
+	}
 	return nil
 }
 
@@ -151,8 +468,16 @@ func collectAudioFiles(path string) ([]string, error) {
 }
 
 func main() {
-	if err := run(); err != nil {
+	err := run(os.Args[1:])
+	var uerr usageError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		os.Exit(exitOK)
+	case errors.As(err, &uerr):
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	default:
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 }
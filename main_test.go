@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"cliamp/config"
+	"cliamp/playlist"
+)
+
+func TestApplyPlayOrder(t *testing.T) {
+	tracks := []playlist.Track{{Path: "/a.mp3"}, {Path: "/b.mp3"}, {Path: "/c.mp3"}}
+	shuffled := playlist.State{Tracks: tracks, Order: []int{2, 0, 1}, Pos: 1, Shuffle: true, Queued: -1}
+	sequential := playlist.State{Tracks: tracks, Order: []int{0, 1, 2}, Queued: -1}
+
+	tests := []struct {
+		name        string
+		session     *playlist.State // nil when nothing was restored
+		shuffle     bool
+		shuffleFlag bool
+		want        bool
+		wantOrder   []int // nil to skip the check
+	}{
+		{name: "new playlist", shuffle: true, want: true},
+		{name: "new playlist unshuffled", want: false},
+		{name: "restored shuffled", session: &shuffled, want: true, wantOrder: []int{2, 0, 1}},
+		{name: "restored sequential", session: &sequential, shuffle: true, want: false, wantOrder: []int{0, 1, 2}},
+		{name: "flag overrides session", session: &shuffled, shuffleFlag: true, want: false, wantOrder: []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pl := playlist.New()
+			if tt.session != nil {
+				pl.Restore(*tt.session)
+			} else {
+				for _, tr := range tracks {
+					pl.Add(tr)
+				}
+			}
+			applyPlayOrder(pl, config.Config{Shuffle: tt.shuffle, Repeat: "all"}, tt.session != nil, tt.shuffleFlag)
+
+			if pl.Shuffled() != tt.want {
+				t.Errorf("Shuffled = %v, want %v", pl.Shuffled(), tt.want)
+			}
+			if got := pl.State().Order; tt.wantOrder != nil && !reflect.DeepEqual(got, tt.wantOrder) {
+				t.Errorf("order = %v, want %v", got, tt.wantOrder)
+			}
+			if pl.Repeat() != playlist.RepeatAll {
+				t.Errorf("repeat = %v, want all", pl.Repeat())
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package mpd
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"cliamp/ipc"
+)
+
+// command executes a single MPD command, writing its response body.
+// The trailing OK or ACK line is written by the caller.
+func (c *client) command(name string, args []string) error {
+	s := c.s
+	arg := ""
+	if len(args) > 0 {
+		arg = args[0]
+	}
+
+	switch name {
+	case "ping", "clearerror":
+
+	case "status":
+		c.writeStatus(s.status())
+
+	case "currentsong":
+		st := s.status()
+		if st.Index >= 0 {
+			writeSong(c, st.Track, st.Index, st.Duration)
+		}
+
+	case "playlistinfo", "playlist", "plchanges", "playlistid":
+		resp, err := s.exec("list")
+		if err != nil {
+			return err
+		}
+		for i, t := range resp.Playlist {
+			writeSong(c, t, i, 0)
+		}
+
+	case "play", "playid":
+		if arg == "" || arg == "-1" {
+			_, err := s.exec("play")
+			return err
+		}
+		pos, err := strconv.Atoi(arg)
+		if err != nil || pos < 0 {
+			return &ackError{ackArg, fmt.Sprintf("invalid song position %q", arg)}
+		}
+		_, err = s.exec("play", strconv.Itoa(pos+1))
+		return err
+
+	case "pause":
+		cmd := "toggle"
+		switch arg {
+		case "1":
+			cmd = "pause"
+		case "0":
+			cmd = "play"
+		}
+		_, err := s.exec(cmd)
+		return err
+
+	case "stop", "next":
+		_, err := s.exec(name)
+		return err
+
+	case "previous":
+		_, err := s.exec("prev")
+		return err
+
+	case "setvol":
+		vol, err := strconv.Atoi(arg)
+		if err != nil || vol < 0 || vol > 100 {
+			return &ackError{ackArg, fmt.Sprintf("invalid volume %q", arg)}
+		}
+		_, err = s.exec("volume", fmt.Sprintf("=%g", percentToDB(vol)))
+		return err
+
+	case "volume":
+		delta, err := strconv.Atoi(arg)
+		if err != nil {
+			return &ackError{ackArg, fmt.Sprintf("invalid volume change %q", arg)}
+		}
+		vol := max(0, min(100, dbToPercent(s.status().Volume)+delta))
+		_, err = s.exec("volume", fmt.Sprintf("=%g", percentToDB(vol)))
+		return err
+
+	case "getvol":
+		fmt.Fprintf(c.w, "volume: %d\n", dbToPercent(s.status().Volume))
+
+	case "seekcur":
+		if !validSeekTime(arg, true) {
+			return &ackError{ackArg, fmt.Sprintf("invalid seek time %q", arg)}
+		}
+		if arg[0] != '+' && arg[0] != '-' {
+			arg = "=" + arg
+		}
+		_, err := s.exec("seek", arg)
+		return err
+
+	case "seek", "seekid":
+		if len(args) < 2 {
+			return &ackError{ackArg, "seek needs a song and a time"}
+		}
+		pos, err := strconv.Atoi(args[0])
+		if err != nil {
+			return &ackError{ackArg, fmt.Sprintf("invalid song position %q", args[0])}
+		}
+		if !validSeekTime(args[1], false) {
+			return &ackError{ackArg, fmt.Sprintf("invalid seek time %q", args[1])}
+		}
+		if st := s.status(); st.Index != pos || st.State == "stopped" {
+			if _, err := s.exec("play", strconv.Itoa(pos+1)); err != nil {
+				return err
+			}
+		}
+		_, err = s.exec("seek", "="+args[1])
+		return err
+
+	case "add", "addid":
+		// The player opens whatever it is given, so only clients on this
+		// machine may add to the playlist
+		if !c.local() {
+			return &ackError{ackPermission, "add is only allowed from this machine"}
+		}
+		if arg == "" {
+			return &ackError{ackArg, "add needs a URI"}
+		}
+		uri, err := localPath(arg)
+		if err != nil {
+			return err
+		}
+		resp, err := s.exec("add", uri)
+		if err != nil {
+			return err
+		}
+		if name == "addid" && resp.Status != nil {
+			fmt.Fprintf(c.w, "Id: %d\n", resp.Status.Tracks-1)
+		}
+
+	case "random":
+		state := "off"
+		if arg == "1" {
+			state = "on"
+		}
+		_, err := s.exec("shuffle", state)
+		return err
+
+	case "repeat", "single":
+		st := s.status()
+		repeat := st.Repeat != "off"
+		single := st.Repeat == "one"
+		if name == "repeat" {
+			repeat = arg == "1"
+		} else {
+			single = arg == "1"
+		}
+		mode := "off"
+		switch {
+		case repeat && single:
+			mode = "one"
+		case repeat:
+			mode = "all"
+		}
+		_, err := s.exec("repeat", mode)
+		return err
+
+	case "stats":
+		st := s.status()
+		fmt.Fprintf(c.w, "songs: %d\n", st.Tracks)
+		fmt.Fprintf(c.w, "uptime: %d\n", int(time.Since(s.started).Seconds()))
+
+	case "outputs":
+		c.w.WriteString("outputsid: 0\noutputname: cliamp\noutputenabled: 1\n")
+
+	case "commands":
+		for _, cmd := range supportedCommands {
+			fmt.Fprintf(c.w, "command: %s\n", cmd)
+		}
+
+	case "tagtypes":
+		for _, tag := range []string{"Artist", "Album", "Title"} {
+			fmt.Fprintf(c.w, "tagtype: %s\n", tag)
+		}
+
+	case "notcommands", "listplaylists", "urlhandlers", "decoders", "channels", "readmessages":
+		// Nothing to report
+
+	case "replay_gain_status":
+		c.w.WriteString("replay_gain_mode: off\n")
+
+	default:
+		return &ackError{ackUnknown, fmt.Sprintf("unknown command %q", name)}
+	}
+	return nil
+}
+
+// supportedCommands is reported by the "commands" command.
+var supportedCommands = []string{
+	"add", "addid", "clearerror", "close", "commands", "currentsong", "getvol",
+	"idle", "next", "noidle", "notcommands", "outputs", "pause", "ping", "play",
+	"playid", "playlist", "playlistid", "playlistinfo", "plchanges", "previous",
+	"random", "repeat", "seek", "seekcur", "seekid", "setvol", "single", "stats",
+	"status", "stop", "tagtypes", "volume",
+}
+
+// validSeekTime reports whether s is a finite time in seconds. A leading
+// + or - makes it relative, which only seekcur allows.
+func validSeekTime(s string, relative bool) bool {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return false
+	}
+	return relative || s[0] != '+' && s[0] != '-'
+}
+
+// localPath resolves the URI given to add: stream URLs are passed on,
+// file:// URIs and paths must name an existing file. Directories are
+// refused, as there is no music database to add their songs from.
+func localPath(uri string) (string, error) {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		uri = u.Path
+	} else if strings.Contains(uri, "://") {
+		return uri, nil
+	}
+	path, err := filepath.Abs(uri)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(path)
+	switch {
+	case err != nil:
+		return "", &ackError{ackNoExist, fmt.Sprintf("no such file %q", path)}
+	case fi.IsDir():
+		return "", &ackError{ackArg, fmt.Sprintf("%q is a directory; add the files in it", path)}
+	}
+	return path, nil
+}
+
+func (c *client) writeStatus(st ipc.Status) {
+	c.s.mu.Lock()
+	version := c.s.version
+	c.s.mu.Unlock()
+
+	state := map[string]string{"playing": "play", "paused": "pause"}[st.State]
+	if state == "" {
+		state = "stop"
+	}
+	fmt.Fprintf(c.w, "volume: %d\n", dbToPercent(st.Volume))
+	fmt.Fprintf(c.w, "repeat: %s\n", boolFlag(st.Repeat != "off"))
+	fmt.Fprintf(c.w, "random: %s\n", boolFlag(st.Shuffle))
+	fmt.Fprintf(c.w, "single: %s\n", boolFlag(st.Repeat == "one"))
+	c.w.WriteString("consume: 0\n")
+	fmt.Fprintf(c.w, "playlist: %d\n", version)
+	fmt.Fprintf(c.w, "playlistlength: %d\n", st.Tracks)
+	fmt.Fprintf(c.w, "state: %s\n", state)
+	if st.Index >= 0 {
+		fmt.Fprintf(c.w, "song: %d\nsongid: %d\n", st.Index, st.Index)
+	}
+	if state != "stop" {
+		fmt.Fprintf(c.w, "time: %d:%d\n", int(st.Position), int(st.Duration))
+		fmt.Fprintf(c.w, "elapsed: %.3f\n", st.Position)
+		fmt.Fprintf(c.w, "duration: %.3f\n", st.Duration)
+	}
+}
+
+// writeSong writes a song entry. Song IDs are playlist positions. The file
+// of a provider track is its "Provider:ID" key, not its stream URL, which
+// carries credentials.
+func writeSong(c *client, t ipc.TrackInfo, pos int, duration float64) {
+	fmt.Fprintf(c.w, "file: %s\n", t.Path)
+	if t.Title != "" {
+		fmt.Fprintf(c.w, "Title: %s\n", t.Title)
+	}
+	if t.Artist != "" {
+		fmt.Fprintf(c.w, "Artist: %s\n", t.Artist)
+	}
+	if t.Album != "" {
+		fmt.Fprintf(c.w, "Album: %s\n", t.Album)
+	}
+	if duration > 0 {
+		fmt.Fprintf(c.w, "Time: %d\nduration: %.3f\n", int(duration), duration)
+	}
+	fmt.Fprintf(c.w, "Pos: %d\nId: %d\n", pos, pos)
+}
+
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// dbToPercent maps the player's [-30, +6] dB range onto MPD's 0-100 volume,
+// matching the TUI volume bar.
+func dbToPercent(db float64) int {
+	return int(math.Round((db + 30) / 36 * 100))
+}
+
+// percentToDB is the inverse of dbToPercent.
+func percentToDB(vol int) float64 {
+	return float64(vol)/100*36 - 30
+}
@@ -0,0 +1,390 @@
+// Package mpd implements a subset of the Music Player Daemon protocol so
+// that existing MPD clients (ncmpcpp, mobile apps) can be used as remotes.
+// Commands are translated into ipc requests and executed by the same
+// handler as the control socket.
+package mpd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cliamp/ipc"
+)
+
+const (
+	// protocolVersion is the MPD protocol version announced to clients.
+	protocolVersion = "0.23.0"
+
+	// pollInterval is how often the player is sampled for idle events.
+	pollInterval = 500 * time.Millisecond
+)
+
+// MPD ACK error codes.
+const (
+	ackArg        = 2
+	ackPermission = 4
+	ackUnknown    = 5
+	ackNoExist    = 50
+	ackSystem     = 52
+)
+
+// ackError is a command failure reported to the client as an ACK line.
+type ackError struct {
+	code int
+	msg  string
+}
+
+func (e *ackError) Error() string { return e.msg }
+
+// Server accepts MPD client connections.
+type Server struct {
+	ln      net.Listener
+	handler ipc.Handler
+	done    chan struct{}
+	started time.Time
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	version int // playlist version, bumped when the playlist changes
+	wg      sync.WaitGroup
+}
+
+// Start listens on addr and serves MPD clients in the background.
+func Start(addr string, h ipc.Handler) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:      ln,
+		handler: h,
+		done:    make(chan struct{}),
+		started: time.Now(),
+		clients: make(map[*client]struct{}),
+		version: 1,
+	}
+	s.wg.Add(2)
+	go s.serve()
+	go s.watch()
+	return s, nil
+}
+
+// Close stops the server and disconnects all clients.
+func (s *Server) Close() error {
+	close(s.done)
+	err := s.ln.Close()
+	s.mu.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		c := newClient(s, conn)
+		s.mu.Lock()
+		s.clients[c] = struct{}{}
+		s.mu.Unlock()
+		go func() {
+			c.run()
+			s.mu.Lock()
+			delete(s.clients, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// watch polls the player and notifies clients of changed subsystems.
+func (s *Server) watch() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	last := s.status()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		cur := s.status()
+		var changed []string
+		if cur.State != last.State || cur.Index != last.Index || cur.Track.Path != last.Track.Path {
+			changed = append(changed, "player")
+		}
+		if cur.Volume != last.Volume {
+			changed = append(changed, "mixer")
+		}
+		if cur.Repeat != last.Repeat || cur.Shuffle != last.Shuffle {
+			changed = append(changed, "options")
+		}
+		if cur.Tracks != last.Tracks || cur.Queue != last.Queue {
+			changed = append(changed, "playlist")
+			s.mu.Lock()
+			s.version++
+			s.mu.Unlock()
+		}
+		last = cur
+
+		if len(changed) > 0 {
+			s.mu.Lock()
+			for c := range s.clients {
+				c.notify(changed)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// status fetches the current player state through the handler.
+func (s *Server) status() ipc.Status {
+	resp := s.handler(ipc.Request{Cmd: "status"})
+	if resp.Status == nil {
+		return ipc.Status{State: "stopped", Index: -1}
+	}
+	return *resp.Status
+}
+
+// exec runs an ipc command, converting failures into ACK errors.
+func (s *Server) exec(cmd string, args ...string) (ipc.Response, error) {
+	resp := s.handler(ipc.Request{Cmd: cmd, Args: args})
+	if !resp.OK {
+		return resp, &ackError{ackSystem, resp.Error}
+	}
+	return resp, nil
+}
+
+// client is a single MPD connection.
+type client struct {
+	s    *Server
+	conn net.Conn
+	w    *bufio.Writer
+
+	mu      sync.Mutex
+	pending map[string]bool // subsystems changed since the last idle
+	wake    chan struct{}
+}
+
+// local reports whether the client connected over loopback, i.e. from this
+// machine.
+func (c *client) local() bool {
+	addr, ok := c.conn.RemoteAddr().(*net.TCPAddr)
+	return ok && addr.IP.IsLoopback()
+}
+
+func newClient(s *Server, conn net.Conn) *client {
+	return &client{
+		s:       s,
+		conn:    conn,
+		w:       bufio.NewWriter(conn),
+		pending: make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// notify records changed subsystems and wakes an idling client.
+func (c *client) notify(subsystems []string) {
+	c.mu.Lock()
+	for _, sub := range subsystems {
+		c.pending[sub] = true
+	}
+	c.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takePending returns and clears pending events matching filter
+// (all events when filter is empty).
+func (c *client) takePending(filter []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []string
+	for sub := range c.pending {
+		if len(filter) == 0 || slices.Contains(filter, sub) {
+			out = append(out, sub)
+			delete(c.pending, sub)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func (c *client) run() {
+	defer c.conn.Close()
+
+	// Read lines on a separate goroutine so idle can watch for noidle
+	lines := make(chan string)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(c.conn)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	fmt.Fprintf(c.w, "OK MPD %s\n", protocolVersion)
+	c.w.Flush()
+
+	var list []string // commands collected inside a command list
+	inList, listOK := false, false
+
+	for line := range lines {
+		name, args, err := parseLine(line)
+		if err != nil {
+			c.ack(0, name, err)
+			c.w.Flush()
+			continue
+		}
+
+		switch {
+		case name == "command_list_begin" || name == "command_list_ok_begin":
+			inList, listOK, list = true, name == "command_list_ok_begin", nil
+			continue
+		case inList && name == "command_list_end":
+			inList = false
+			c.runList(list, listOK)
+		case inList:
+			list = append(list, line)
+			continue
+		case name == "close":
+			c.w.Flush()
+			return
+		case name == "idle":
+			if !c.idle(args, lines) {
+				return
+			}
+		case name == "noidle":
+			// Not idling; MPD ignores a stray noidle
+			continue
+		default:
+			if err := c.command(name, args); err != nil {
+				c.ack(0, name, err)
+			} else {
+				c.w.WriteString("OK\n")
+			}
+		}
+		if err := c.w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// runList executes a command list, stopping at the first failure.
+func (c *client) runList(list []string, listOK bool) {
+	for i, line := range list {
+		name, args, err := parseLine(line)
+		if err == nil {
+			err = c.command(name, args)
+		}
+		if err != nil {
+			c.ack(i, name, err)
+			return
+		}
+		if listOK {
+			c.w.WriteString("list_OK\n")
+		}
+	}
+	c.w.WriteString("OK\n")
+}
+
+// idle blocks until one of the requested subsystems changes or the client
+// sends noidle. Returns false if the connection was closed.
+func (c *client) idle(filter []string, lines <-chan string) bool {
+	for {
+		if changed := c.takePending(filter); len(changed) > 0 {
+			for _, sub := range changed {
+				fmt.Fprintf(c.w, "changed: %s\n", sub)
+			}
+			c.w.WriteString("OK\n")
+			return true
+		}
+		select {
+		case <-c.wake:
+		case line, ok := <-lines:
+			if !ok {
+				return false
+			}
+			if strings.TrimSpace(line) == "noidle" {
+				c.w.WriteString("OK\n")
+				return true
+			}
+		case <-c.s.done:
+			return false
+		}
+	}
+}
+
+func (c *client) ack(index int, name string, err error) {
+	code := ackSystem
+	var ae *ackError
+	if errors.As(err, &ae) {
+		code = ae.code
+	}
+	fmt.Fprintf(c.w, "ACK [%d@%d] {%s} %s\n", code, index, name, err)
+}
+
+// parseLine splits a command line into its name and arguments, honoring
+// double-quoted arguments with backslash escapes.
+func parseLine(line string) (string, []string, error) {
+	var tokens []string
+	var cur strings.Builder
+	inQuote, escaped, started := false, false, false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+			started = true
+		case !inQuote && (r == ' ' || r == '\t'):
+			if started {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				started = false
+			}
+		default:
+			cur.WriteRune(r)
+			started = true
+		}
+	}
+	if inQuote {
+		return "", nil, &ackError{ackArg, "unterminated quoted argument"}
+	}
+	if started {
+		tokens = append(tokens, cur.String())
+	}
+	if len(tokens) == 0 {
+		return "", nil, &ackError{ackUnknown, "no command given"}
+	}
+	return tokens[0], tokens[1:], nil
+}
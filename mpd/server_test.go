@@ -0,0 +1,200 @@
+package mpd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"cliamp/ipc"
+)
+
+// fakePlayer is an ipc.Handler with a fixed playlist that records the
+// commands it is given.
+type fakePlayer struct {
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (p *fakePlayer) handle(req ipc.Request) ipc.Response {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if req.Cmd != "status" {
+		p.cmds = append(p.cmds, strings.Join(append([]string{req.Cmd}, req.Args...), " "))
+	}
+	st := ipc.Status{
+		State:    "playing",
+		Track:    ipc.TrackInfo{Path: "Navidrome:42", Title: "Remote", Artist: "Band"},
+		Index:    1,
+		Position: 12.5,
+		Duration: 200,
+		Volume:   -30,
+		Repeat:   "one",
+		Tracks:   2,
+	}
+	return ipc.Response{OK: true, Status: &st, Playlist: []ipc.TrackInfo{
+		{Path: "/music/a.mp3", Title: "A"},
+		{Path: "Navidrome:42", Title: "Remote", Artist: "Band"},
+	}}
+}
+
+// conn is the client side of an MPD connection.
+type conn struct {
+	t *testing.T
+	c net.Conn
+	r *bufio.Reader
+}
+
+func newConn(t *testing.T, c net.Conn) *conn {
+	t.Helper()
+	cn := &conn{t: t, c: c, r: bufio.NewReader(c)}
+	if greeting := cn.line(); !strings.HasPrefix(greeting, "OK MPD ") {
+		t.Fatalf("greeting = %q", greeting)
+	}
+	return cn
+}
+
+func (cn *conn) line() string {
+	cn.t.Helper()
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		cn.t.Fatalf("reading response: %v", err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+// send runs a command and returns the response lines, ending with the
+// OK or ACK line.
+func (cn *conn) send(cmd string) []string {
+	cn.t.Helper()
+	fmt.Fprintf(cn.c, "%s\n", cmd)
+	var lines []string
+	for {
+		line := cn.line()
+		lines = append(lines, line)
+		if line == "OK" || strings.HasPrefix(line, "ACK ") {
+			return lines
+		}
+	}
+}
+
+// dial connects to a server for p over loopback TCP.
+func dial(t *testing.T, p *fakePlayer) *conn {
+	t.Helper()
+	s, err := Start("127.0.0.1:0", p.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	c, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return newConn(t, c)
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.mp3", "a b.mp3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := filepath.Join(dir, "b.mp3")
+	missing := filepath.Join(dir, "missing.mp3")
+
+	tests := []struct {
+		cmd      string
+		want     []string
+		wantCmds []string
+	}{
+		{cmd: "ping", want: []string{"OK"}},
+		{
+			cmd:  "currentsong",
+			want: []string{"file: Navidrome:42", "Title: Remote", "Artist: Band", "Time: 200", "duration: 200.000", "Pos: 1", "Id: 1", "OK"},
+		},
+		{
+			cmd: "playlistinfo",
+			want: []string{
+				"file: /music/a.mp3", "Title: A", "Pos: 0", "Id: 0",
+				"file: Navidrome:42", "Title: Remote", "Artist: Band", "Pos: 1", "Id: 1",
+				"OK",
+			},
+			wantCmds: []string{"list"},
+		},
+		{cmd: "play 0", want: []string{"OK"}, wantCmds: []string{"play 1"}},
+		{cmd: "pause 1", want: []string{"OK"}, wantCmds: []string{"pause"}},
+		{cmd: "setvol 100", want: []string{"OK"}, wantCmds: []string{"volume =6"}},
+		{cmd: "seekcur +10", want: []string{"OK"}, wantCmds: []string{"seek +10"}},
+		{cmd: "seekcur nan", want: []string{`ACK [2@0] {seekcur} invalid seek time "nan"`}},
+		{cmd: "seek 1 30", want: []string{"OK"}, wantCmds: []string{"seek =30"}},
+		{cmd: "seek 1 soon", want: []string{`ACK [2@0] {seek} invalid seek time "soon"`}},
+		{cmd: "seekid 1 -5", want: []string{`ACK [2@0] {seekid} invalid seek time "-5"`}},
+		{cmd: "random 1", want: []string{"OK"}, wantCmds: []string{"shuffle on"}},
+		{cmd: "single 0", want: []string{"OK"}, wantCmds: []string{"repeat all"}},
+		{cmd: fmt.Sprintf("add %q", b), want: []string{"OK"}, wantCmds: []string{"add " + b}},
+		{
+			cmd:      fmt.Sprintf("add %q", "file://"+filepath.ToSlash(dir)+"/a%20b.mp3"),
+			want:     []string{"OK"},
+			wantCmds: []string{"add " + filepath.Join(dir, "a b.mp3")},
+		},
+		{
+			cmd:      `addid "https://radio.example/live"`,
+			want:     []string{"Id: 1", "OK"},
+			wantCmds: []string{"add https://radio.example/live"},
+		},
+		{cmd: fmt.Sprintf("add %q", dir), want: []string{fmt.Sprintf("ACK [2@0] {add} %q is a directory; add the files in it", dir)}},
+		{cmd: fmt.Sprintf("add %q", missing), want: []string{fmt.Sprintf("ACK [50@0] {add} no such file %q", missing)}},
+		{cmd: "add", want: []string{"ACK [2@0] {add} add needs a URI"}},
+		{cmd: "setvol loud", want: []string{`ACK [2@0] {setvol} invalid volume "loud"`}},
+		{cmd: "frobnicate", want: []string{`ACK [5@0] {frobnicate} unknown command "frobnicate"`}},
+	}
+	p := &fakePlayer{}
+	cn := dial(t, p)
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			p.mu.Lock()
+			p.cmds = nil
+			p.mu.Unlock()
+
+			if got := cn.send(tt.cmd); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("response = %q\nwant %q", got, tt.want)
+			}
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if !reflect.DeepEqual(p.cmds, tt.wantCmds) {
+				t.Errorf("commands = %q, want %q", p.cmds, tt.wantCmds)
+			}
+		})
+	}
+}
+
+func TestAddOnlyFromThisMachine(t *testing.T) {
+	p := &fakePlayer{}
+	s := &Server{handler: p.handle, done: make(chan struct{}), clients: make(map[*client]struct{})}
+
+	// A pipe has no loopback address, like a client on another machine
+	server, client := net.Pipe()
+	defer client.Close()
+	go newClient(s, server).run()
+	cn := newConn(t, client)
+
+	for _, cmd := range []string{`add "/etc/passwd"`, `addid "http://evil.example/x"`} {
+		want := fmt.Sprintf("ACK [4@0] {%s} add is only allowed from this machine", strings.Fields(cmd)[0])
+		if got := cn.send(cmd); !reflect.DeepEqual(got, []string{want}) {
+			t.Errorf("%s: response = %q, want %q", cmd, got, want)
+		}
+	}
+	if got := cn.send("ping"); !reflect.DeepEqual(got, []string{"OK"}) {
+		t.Errorf("ping: response = %q", got)
+	}
+	if len(p.cmds) != 0 {
+		t.Errorf("commands = %q, want none", p.cmds)
+	}
+}
@@ -0,0 +1,381 @@
+//go:build linux
+
+// Package mpris exposes the player on the D-Bus session bus through the
+// org.mpris.MediaPlayer2 interfaces, so media keys, desktop shell widgets
+// and playerctl can control cliamp. Commands are bridged to the same
+// ipc.Handler used by the control socket.
+package mpris
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"cliamp/ipc"
+)
+
+const (
+	busName     = "org.mpris.MediaPlayer2.cliamp"
+	objectPath  = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	rootIface   = "org.mpris.MediaPlayer2"
+	playerIface = "org.mpris.MediaPlayer2.Player"
+
+	// pollInterval is how often player state is sampled for change signals.
+	pollInterval = 500 * time.Millisecond
+)
+
+// Server owns the session bus connection and the exported MPRIS objects.
+type Server struct {
+	conn    *dbus.Conn
+	props   *prop.Properties
+	handler ipc.Handler
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Start connects to the session bus and exports the MPRIS interfaces.
+// It returns (nil, nil) when no session bus is configured.
+func Start(h ipc.Handler) (*Server, error) {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, nil
+	}
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+	s, err := export(conn, h)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// export registers the MPRIS objects on conn and claims the bus name. It
+// does not wait for the player, which only answers once its program is
+// running: the properties start out as stopped and are filled in by the
+// first poll.
+func export(conn *dbus.Conn, h ipc.Handler) (*Server, error) {
+	s := &Server{conn: conn, handler: h, done: make(chan struct{})}
+	status := stopped
+
+	root := &rootObject{}
+	player := &playerObject{s: s}
+	if err := conn.Export(root, objectPath, rootIface); err != nil {
+		return nil, err
+	}
+	if err := conn.ExportWithMap(player, playerMethods, objectPath, playerIface); err != nil {
+		return nil, err
+	}
+
+	props, err := prop.Export(conn, objectPath, prop.Map{
+		rootIface: {
+			"CanQuit":             {Value: false, Emit: prop.EmitConst},
+			"CanRaise":            {Value: false, Emit: prop.EmitConst},
+			"HasTrackList":        {Value: false, Emit: prop.EmitConst},
+			"Identity":            {Value: "cliamp", Emit: prop.EmitConst},
+			"SupportedUriSchemes": {Value: []string{"file", "http", "https"}, Emit: prop.EmitConst},
+			"SupportedMimeTypes":  {Value: []string{"audio/mpeg", "audio/flac", "audio/ogg", "audio/wav"}, Emit: prop.EmitConst},
+		},
+		playerIface: {
+			"PlaybackStatus": {Value: playbackStatus(status), Emit: prop.EmitTrue},
+			"LoopStatus":     {Value: loopStatus(status), Writable: true, Emit: prop.EmitTrue, Callback: s.setLoopStatus},
+			"Rate":           {Value: 1.0, Writable: true, Emit: prop.EmitTrue, Callback: func(*prop.Change) *dbus.Error { return nil }},
+			"Shuffle":        {Value: status.Shuffle, Writable: true, Emit: prop.EmitTrue, Callback: s.setShuffle},
+			"Metadata":       {Value: metadata(status), Emit: prop.EmitTrue},
+			"Volume":         {Value: dbToLinear(status.Volume), Writable: true, Emit: prop.EmitTrue, Callback: s.setVolume},
+			"Position":       {Value: micros(status.Position), Emit: prop.EmitFalse},
+			"MinimumRate":    {Value: 1.0, Emit: prop.EmitConst},
+			"MaximumRate":    {Value: 1.0, Emit: prop.EmitConst},
+			"CanGoNext":      {Value: true, Emit: prop.EmitConst},
+			"CanGoPrevious":  {Value: true, Emit: prop.EmitConst},
+			"CanPlay":        {Value: true, Emit: prop.EmitConst},
+			"CanPause":       {Value: true, Emit: prop.EmitConst},
+			"CanSeek":        {Value: true, Emit: prop.EmitConst},
+			"CanControl":     {Value: true, Emit: prop.EmitConst},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.props = props
+
+	node := &introspect.Node{
+		Name: string(objectPath),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{Name: rootIface, Methods: introspect.Methods(root), Properties: props.Introspection(rootIface)},
+			{
+				Name:       playerIface,
+				Methods:    playerIntrospection(player),
+				Properties: props.Introspection(playerIface),
+				Signals:    []introspect.Signal{{Name: "Seeked", Args: []introspect.Arg{{Name: "Position", Type: "x"}}}},
+			},
+		},
+	}
+	if err := conn.Export(introspect.NewIntrospectable(node), objectPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return nil, err
+	}
+
+	// A second instance takes a unique name as the MPRIS spec suggests
+	reply, err := conn.RequestName(busName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return nil, err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		name := fmt.Sprintf("%s.instance%d", busName, os.Getpid())
+		if _, err := conn.RequestName(name, dbus.NameFlagDoNotQueue); err != nil {
+			return nil, err
+		}
+	}
+
+	s.wg.Add(1)
+	go s.watch(status)
+	return s, nil
+}
+
+// Close releases the bus name and stops emitting signals.
+func (s *Server) Close() {
+	if s == nil {
+		return
+	}
+	close(s.done)
+	s.wg.Wait()
+	s.conn.Close()
+}
+
+// stopped is the state reported when the player cannot be reached.
+var stopped = ipc.Status{State: "stopped", Index: -1}
+
+// status fetches the current player state through the handler.
+func (s *Server) status() ipc.Status {
+	resp := s.handler(ipc.Request{Cmd: "status"})
+	if resp.Status == nil {
+		return stopped
+	}
+	return *resp.Status
+}
+
+// command runs a player command, converting failures into D-Bus errors.
+func (s *Server) command(cmd string, args ...string) *dbus.Error {
+	resp := s.handler(ipc.Request{Cmd: cmd, Args: args})
+	if !resp.OK {
+		return dbus.MakeFailedError(errors.New(resp.Error))
+	}
+	return nil
+}
+
+// watch polls the player and emits PropertiesChanged and Seeked signals.
+// The first poll runs right away and returns once the player answers.
+func (s *Server) watch(last ipc.Status) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastPoll := time.Now()
+
+	for {
+		cur := s.status()
+		now := time.Now()
+		s.update("PlaybackStatus", playbackStatus(cur))
+		s.update("LoopStatus", loopStatus(cur))
+		s.update("Shuffle", cur.Shuffle)
+		s.update("Volume", dbToLinear(cur.Volume))
+		s.update("Metadata", metadata(cur))
+		s.props.SetMust(playerIface, "Position", micros(cur.Position))
+
+		// Report jumps that are not explained by normal playback
+		expected := last.Position
+		if last.State == "playing" {
+			expected += now.Sub(lastPoll).Seconds()
+		}
+		if cur.Index == last.Index && math.Abs(cur.Position-expected) > 1.5 {
+			s.conn.Emit(objectPath, playerIface+".Seeked", micros(cur.Position))
+		}
+		last, lastPoll = cur, now
+
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update sets a player property only when its value changed, so that
+// PropertiesChanged is not emitted on every poll.
+func (s *Server) update(name string, v any) {
+	if reflect.DeepEqual(s.props.GetMust(playerIface, name), v) {
+		return
+	}
+	s.props.SetMust(playerIface, name, v)
+}
+
+func (s *Server) setLoopStatus(c *prop.Change) *dbus.Error {
+	mode := map[string]string{"None": "off", "Playlist": "all", "Track": "one"}[c.Value.(string)]
+	if mode == "" {
+		return prop.ErrInvalidArg
+	}
+	return s.command("repeat", mode)
+}
+
+func (s *Server) setShuffle(c *prop.Change) *dbus.Error {
+	if c.Value.(bool) {
+		return s.command("shuffle", "on")
+	}
+	return s.command("shuffle", "off")
+}
+
+func (s *Server) setVolume(c *prop.Change) *dbus.Error {
+	return s.command("volume", fmt.Sprintf("=%g", linearToDB(c.Value.(float64))))
+}
+
+// rootObject implements the org.mpris.MediaPlayer2 methods.
+type rootObject struct{}
+
+func (rootObject) Raise() *dbus.Error { return nil }
+func (rootObject) Quit() *dbus.Error  { return nil }
+
+// playerMethods maps Go method names that differ from their D-Bus names.
+var playerMethods = map[string]string{"SeekBy": "Seek"}
+
+// playerIntrospection lists the player methods under their D-Bus names.
+func playerIntrospection(p *playerObject) []introspect.Method {
+	methods := introspect.Methods(p)
+	for i, m := range methods {
+		if name, ok := playerMethods[m.Name]; ok {
+			methods[i].Name = name
+		}
+	}
+	return methods
+}
+
+// playerObject implements the org.mpris.MediaPlayer2.Player methods.
+type playerObject struct {
+	s *Server
+}
+
+func (p *playerObject) Next() *dbus.Error      { return p.s.command("next") }
+func (p *playerObject) Previous() *dbus.Error  { return p.s.command("prev") }
+func (p *playerObject) Pause() *dbus.Error     { return p.s.command("pause") }
+func (p *playerObject) PlayPause() *dbus.Error { return p.s.command("toggle") }
+func (p *playerObject) Stop() *dbus.Error      { return p.s.command("stop") }
+func (p *playerObject) Play() *dbus.Error      { return p.s.command("play") }
+
+// SeekBy implements Seek, moving the position by offset microseconds. It is
+// renamed on export so it does not clash with the io.Seeker signature.
+func (p *playerObject) SeekBy(offset int64) *dbus.Error {
+	return p.s.command("seek", fmt.Sprintf("%+g", float64(offset)/1e6))
+}
+
+// SetPosition seeks to an absolute position if trackID is still current.
+func (p *playerObject) SetPosition(trackID dbus.ObjectPath, pos int64) *dbus.Error {
+	if trackID != trackPath(p.s.status()) || pos < 0 {
+		return nil
+	}
+	return p.s.command("seek", fmt.Sprintf("%g", float64(pos)/1e6))
+}
+
+// OpenUri queues a file or URL and skips to it. Only the schemes listed in
+// SupportedUriSchemes are accepted.
+func (p *playerObject) OpenUri(uri string) *dbus.Error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return dbus.MakeFailedError(fmt.Errorf("invalid URI %q: %w", uri, err))
+	}
+	path := uri
+	switch u.Scheme {
+	case "file":
+		path = u.Path
+	case "http", "https":
+	default:
+		return dbus.MakeFailedError(fmt.Errorf("unsupported URI %q: want file, http or https", uri))
+	}
+	if err := p.s.command("queue", path); err != nil {
+		return err
+	}
+	return p.s.command("next")
+}
+
+func playbackStatus(s ipc.Status) string {
+	switch s.State {
+	case "playing":
+		return "Playing"
+	case "paused":
+		return "Paused"
+	}
+	return "Stopped"
+}
+
+func loopStatus(s ipc.Status) string {
+	switch s.Repeat {
+	case "all":
+		return "Playlist"
+	case "one":
+		return "Track"
+	}
+	return "None"
+}
+
+// trackPath returns the mpris:trackid object path for the current track.
+func trackPath(s ipc.Status) dbus.ObjectPath {
+	if s.Index < 0 {
+		return "/org/mpris/MediaPlayer2/TrackList/NoTrack"
+	}
+	return dbus.ObjectPath(fmt.Sprintf("/org/cliamp/track/%d", s.Index))
+}
+
+func metadata(s ipc.Status) map[string]dbus.Variant {
+	md := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(trackPath(s)),
+	}
+	if s.Index < 0 {
+		return md
+	}
+	md["mpris:length"] = dbus.MakeVariant(micros(s.Duration))
+	md["xesam:title"] = dbus.MakeVariant(s.Track.Title)
+	if s.Track.Artist != "" {
+		md["xesam:artist"] = dbus.MakeVariant([]string{s.Track.Artist})
+	}
+	if s.Track.Album != "" {
+		md["xesam:album"] = dbus.MakeVariant(s.Track.Album)
+	}
+	// Provider tracks are reported by their "Provider:ID" key, which has
+	// no URL to give
+	switch url := s.Track.Path; {
+	case strings.Contains(url, "://"):
+		md["xesam:url"] = dbus.MakeVariant(url)
+	case filepath.IsAbs(url):
+		md["xesam:url"] = dbus.MakeVariant("file://" + url)
+	}
+	return md
+}
+
+// micros converts seconds to the microsecond timestamps used by MPRIS.
+func micros(sec float64) int64 {
+	return int64(sec * 1e6)
+}
+
+// dbToLinear maps the player's dB volume onto the MPRIS linear scale.
+func dbToLinear(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// linearToDB maps an MPRIS linear volume back to dB.
+func linearToDB(v float64) float64 {
+	if v <= 0 {
+		return -30
+	}
+	return 20 * math.Log10(v)
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package mpris
+
+import "cliamp/ipc"
+
+// Server is a no-op on platforms without a D-Bus session bus.
+type Server struct{}
+
+// Start does nothing outside Linux.
+func Start(h ipc.Handler) (*Server, error) {
+	return nil, nil
+}
+
+// Close does nothing outside Linux.
+func (s *Server) Close() {}
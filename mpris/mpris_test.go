@@ -0,0 +1,263 @@
+//go:build linux
+
+package mpris
+
+import (
+	"bufio"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"cliamp/ipc"
+)
+
+// fakePlayer is an ipc.Handler that records commands and reports a fixed
+// status.
+type fakePlayer struct {
+	mu     sync.Mutex
+	status ipc.Status
+	cmds   []string
+}
+
+func (p *fakePlayer) handle(req ipc.Request) ipc.Response {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if req.Cmd != "status" {
+		p.cmds = append(p.cmds, strings.Join(append([]string{req.Cmd}, req.Args...), " "))
+	}
+	st := p.status
+	return ipc.Response{OK: true, Status: &st}
+}
+
+func (p *fakePlayer) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cmds := p.cmds
+	p.cmds = nil
+	return cmds
+}
+
+// privateBus starts a dbus-daemon for the test and returns its address.
+func privateBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading bus address: %v", err)
+	}
+	return strings.TrimSpace(addr)
+}
+
+func connect(t *testing.T, addr string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// startServer exports a server for h on a private bus and returns a client
+// connection to the same bus.
+func startServer(t *testing.T, h ipc.Handler) (*Server, dbus.BusObject) {
+	t.Helper()
+	addr := privateBus(t)
+	s, err := export(connect(t, addr), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	client := connect(t, addr)
+	t.Cleanup(func() { client.Close() })
+	return s, client.Object(busName, objectPath)
+}
+
+// waitProperty polls a player property until it equals want.
+func waitProperty(t *testing.T, obj dbus.BusObject, name string, want any) {
+	t.Helper()
+	var got any
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		v, err := obj.GetProperty(playerIface + "." + name)
+		if err != nil {
+			t.Fatalf("get %s: %v", name, err)
+		}
+		if got = v.Value(); reflect.DeepEqual(got, want) {
+			return
+		}
+	}
+	t.Errorf("%s = %#v, want %#v", name, got, want)
+}
+
+func TestExportDoesNotWaitForPlayer(t *testing.T) {
+	// Like ui.RemoteHandler before the program runs, the handler only
+	// answers after a timeout
+	release := make(chan struct{})
+	defer close(release)
+	slow := func(ipc.Request) ipc.Response {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+		return ipc.Response{Error: "timed out waiting for player"}
+	}
+
+	start := time.Now()
+	_, obj := startServer(t, slow)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("export took %v", d)
+	}
+	waitProperty(t, obj, "PlaybackStatus", "Stopped")
+}
+
+func TestProperties(t *testing.T) {
+	p := &fakePlayer{status: ipc.Status{
+		State:    "playing",
+		Track:    ipc.TrackInfo{Path: "/music/song.mp3", Title: "Song", Artist: "Artist", Album: "Album"},
+		Index:    2,
+		Position: 10,
+		Duration: 180,
+		Repeat:   "all",
+		Shuffle:  true,
+	}}
+	_, obj := startServer(t, p.handle)
+
+	waitProperty(t, obj, "PlaybackStatus", "Playing")
+	tests := []struct {
+		name string
+		want any
+	}{
+		{"LoopStatus", "Playlist"},
+		{"Shuffle", true},
+		{"Volume", 1.0},
+		{"Position", int64(10e6)},
+		{"Metadata", map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/org/cliamp/track/2")),
+			"mpris:length":  dbus.MakeVariant(int64(180e6)),
+			"xesam:title":   dbus.MakeVariant("Song"),
+			"xesam:artist":  dbus.MakeVariant([]string{"Artist"}),
+			"xesam:album":   dbus.MakeVariant("Album"),
+			"xesam:url":     dbus.MakeVariant("file:///music/song.mp3"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waitProperty(t, obj, tt.name, tt.want)
+		})
+	}
+}
+
+func TestMetadataURL(t *testing.T) {
+	tests := []struct {
+		path string
+		want string // "" for no xesam:url
+	}{
+		{"/music/a.mp3", "file:///music/a.mp3"},
+		{"https://radio.example/live", "https://radio.example/live"},
+		{"Navidrome:42", ""},
+	}
+	for _, tt := range tests {
+		md := metadata(ipc.Status{Index: 0, Track: ipc.TrackInfo{Path: tt.path}})
+		got := ""
+		if v, ok := md["xesam:url"]; ok {
+			got = v.Value().(string)
+		}
+		if got != tt.want {
+			t.Errorf("xesam:url for %q = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	p := &fakePlayer{status: ipc.Status{State: "playing", Index: 1, Duration: 60}}
+	_, obj := startServer(t, p.handle)
+
+	tests := []struct {
+		method string
+		args   []any
+		want   []string
+	}{
+		{"Next", nil, []string{"next"}},
+		{"Previous", nil, []string{"prev"}},
+		{"Play", nil, []string{"play"}},
+		{"Pause", nil, []string{"pause"}},
+		{"PlayPause", nil, []string{"toggle"}},
+		{"Stop", nil, []string{"stop"}},
+		{"Seek", []any{int64(5e6)}, []string{"seek +5"}},
+		{"Seek", []any{int64(-2500000)}, []string{"seek -2.5"}},
+		{"SetPosition", []any{dbus.ObjectPath("/org/cliamp/track/1"), int64(30e6)}, []string{"seek 30"}},
+		{"SetPosition", []any{dbus.ObjectPath("/org/cliamp/track/0"), int64(30e6)}, nil},
+		{"OpenUri", []any{"file:///music/a%20b.mp3"}, []string{"queue /music/a b.mp3", "next"}},
+		{"OpenUri", []any{"https://radio.example/live"}, []string{"queue https://radio.example/live", "next"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			p.take()
+			if err := obj.Call(playerIface+"."+tt.method, 0, tt.args...).Err; err != nil {
+				t.Fatal(err)
+			}
+			if got := p.take(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenUriRejects(t *testing.T) {
+	p := &fakePlayer{status: ipc.Status{State: "stopped", Index: -1}}
+	_, obj := startServer(t, p.handle)
+
+	for _, uri := range []string{"/music/a.mp3", "smb://nas/music/a.mp3", "file://%zz"} {
+		if err := obj.Call(playerIface+".OpenUri", 0, uri).Err; err == nil {
+			t.Errorf("OpenUri(%q) succeeded", uri)
+		}
+	}
+	if got := p.take(); got != nil {
+		t.Errorf("commands = %q, want none", got)
+	}
+}
+
+func TestSetProperties(t *testing.T) {
+	p := &fakePlayer{status: ipc.Status{State: "stopped", Index: -1}}
+	_, obj := startServer(t, p.handle)
+
+	tests := []struct {
+		name  string
+		value any
+		want  []string
+	}{
+		{"LoopStatus", "Track", []string{"repeat one"}},
+		{"LoopStatus", "None", []string{"repeat off"}},
+		{"Shuffle", true, []string{"shuffle on"}},
+		{"Volume", 1.0, []string{"volume =0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.take()
+			if err := obj.SetProperty(playerIface+"."+tt.name, dbus.MakeVariant(tt.value)); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.take(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,4 +1,4 @@
-package ui
+package player
 
 // EQPreset is a named 10-band EQ curve.
 type EQPreset struct {
@@ -6,9 +6,9 @@ type EQPreset struct {
 	Bands [10]float64
 }
 
-// eqPresets is the ordered list of built-in EQ presets.
-// Bands: 70Hz, 180Hz, 320Hz, 600Hz, 1kHz, 3kHz, 6kHz, 12kHz, 14kHz, 16kHz
-var eqPresets = []EQPreset{
+// EQPresets is the ordered list of built-in EQ presets, with bands at EQFreqs:
+// 70Hz, 180Hz, 320Hz, 600Hz, 1kHz, 3kHz, 6kHz, 12kHz, 14kHz, 16kHz
+var EQPresets = []EQPreset{
 	{"Flat", [10]float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
 	{"Rock", [10]float64{5, 4, 2, -1, -2, 2, 4, 5, 5, 5}},
 	{"Pop", [10]float64{-1, 2, 4, 5, 4, 1, -1, -1, 1, 2}},
@@ -20,3 +20,12 @@ var eqPresets = []EQPreset{
 	{"Electronic", [10]float64{6, 4, 1, -1, -2, 1, 3, 4, 5, 6}},
 	{"Acoustic", [10]float64{3, 3, 2, 0, 1, 2, 3, 3, 2, 1}},
 }
+
+// EQPresetNames returns the names of the built-in EQ presets in order.
+func EQPresetNames() []string {
+	names := make([]string, len(EQPresets))
+	for i, p := range EQPresets {
+		names[i] = p.Name
+	}
+	return names
+}
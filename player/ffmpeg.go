@@ -4,7 +4,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"os/exec"
-	"path/filepath"
 	"strconv"
 
 	"github.com/gopxl/beep/v2"
@@ -13,12 +12,12 @@ import (
 // pcmFrameSize is the byte size of one stereo s16le sample frame (2 channels * 2 bytes).
 const pcmFrameSize = 4
 
-// decodeFFmpeg uses ffmpeg to decode any audio file into raw PCM,
-// returning a seekable beep.StreamSeekCloser.
-func decodeFFmpeg(path string, sr beep.SampleRate) (beep.StreamSeekCloser, beep.Format, error) {
+// decodeFFmpeg uses ffmpeg to decode any audio file or stream URL into raw
+// PCM, returning a seekable beep.StreamSeekCloser. name is the
+// detected format, used in errors.
+func decodeFFmpeg(path, name string, sr beep.SampleRate) (beep.StreamSeekCloser, beep.Format, error) {
 	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		ext := filepath.Ext(path)
-		return nil, beep.Format{}, fmt.Errorf("ffmpeg is required to play %s files — install it with your package manager", ext)
+		return nil, beep.Format{}, fmt.Errorf("ffmpeg is required to play %s files — install it with your package manager", name)
 	}
 
 	cmd := exec.Command("ffmpeg",
@@ -0,0 +1,55 @@
+package player
+
+import "github.com/gopxl/beep/v2"
+
+// abLoop wraps the decoded source and, while enabled, jumps from point B
+// back to point A. Positions are in source samples so the loop is
+// sample-accurate regardless of resampling further down the pipeline.
+// All fields are guarded by the speaker lock.
+type abLoop struct {
+	s       beep.StreamSeeker
+	a, b    int   // loop boundaries in source samples
+	hasA    bool  // a has been set
+	enabled bool  // both points set and b > a
+	err     error // a failed seek back to a, reported by Err
+}
+
+func (l *abLoop) Stream(samples [][2]float64) (int, bool) {
+	if !l.enabled {
+		return l.s.Stream(samples)
+	}
+
+	n := 0
+	for n < len(samples) {
+		pos := l.s.Position()
+		if pos >= l.b {
+			if err := l.s.Seek(l.a); err != nil {
+				l.err = err
+				return n, n > 0
+			}
+			pos = l.a
+		}
+		want := min(len(samples)-n, l.b-pos)
+		k, ok := l.s.Stream(samples[n : n+want])
+		n += k
+		if !ok {
+			return n, n > 0
+		}
+		if k == 0 {
+			break
+		}
+	}
+	return n, true
+}
+
+func (l *abLoop) Err() error {
+	if l.err != nil {
+		return l.err
+	}
+	return l.s.Err()
+}
+
+// clear removes both loop points.
+func (l *abLoop) clear() {
+	*l = abLoop{s: l.s}
+}
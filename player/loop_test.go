@@ -0,0 +1,166 @@
+package player
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// counter is a seekable source whose samples hold their own index, so the
+// order in which they are played can be checked.
+type counter struct {
+	pos, len int
+	failSeek bool
+}
+
+func (c *counter) Stream(samples [][2]float64) (int, bool) {
+	n := min(len(samples), c.len-c.pos)
+	for i := range n {
+		v := float64(c.pos + i)
+		samples[i] = [2]float64{v, v}
+	}
+	c.pos += n
+	return n, n > 0
+}
+
+func (c *counter) Err() error    { return nil }
+func (c *counter) Len() int      { return c.len }
+func (c *counter) Position() int { return c.pos }
+func (c *counter) Close() error  { return nil }
+
+func (c *counter) Seek(p int) error {
+	if c.failSeek {
+		return errors.New("seek failed")
+	}
+	c.pos = p
+	return nil
+}
+
+// stream pulls n samples from s and returns their left channel.
+func stream(s beep.Streamer, n int) ([]float64, bool) {
+	buf := make([][2]float64, n)
+	k, ok := s.Stream(buf)
+	got := make([]float64, k)
+	for i := range k {
+		got[i] = buf[i][0]
+	}
+	return got, ok
+}
+
+func TestABLoop(t *testing.T) {
+	tests := []struct {
+		name   string
+		start  int
+		loop   abLoop
+		n      int
+		want   []float64
+		wantOK bool
+	}{
+		{
+			name:   "disabled",
+			loop:   abLoop{a: 2, b: 5, hasA: true},
+			n:      8,
+			want:   []float64{0, 1, 2, 3, 4, 5, 6, 7},
+			wantOK: true,
+		},
+		{
+			name:   "wraps at b",
+			loop:   abLoop{a: 2, b: 5, hasA: true, enabled: true},
+			n:      10,
+			want:   []float64{0, 1, 2, 3, 4, 2, 3, 4, 2, 3},
+			wantOK: true,
+		},
+		{
+			name:   "past b",
+			start:  8,
+			loop:   abLoop{a: 2, b: 5, hasA: true, enabled: true},
+			n:      4,
+			want:   []float64{2, 3, 4, 2},
+			wantOK: true,
+		},
+		{
+			name:   "end of source",
+			start:  17,
+			loop:   abLoop{a: 2, b: 30, hasA: true, enabled: true},
+			n:      5,
+			want:   []float64{17, 18, 19},
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.loop
+			l.s = &counter{pos: tt.start, len: 20}
+			got, ok := stream(&l, tt.n)
+			if !reflect.DeepEqual(got, tt.want) || ok != tt.wantOK {
+				t.Errorf("Stream = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestABLoopSeekError(t *testing.T) {
+	src := &counter{pos: 3, len: 20, failSeek: true}
+	l := &abLoop{s: src, a: 2, b: 5, hasA: true, enabled: true}
+
+	if got, ok := stream(l, 4); !reflect.DeepEqual(got, []float64{3, 4}) || !ok {
+		t.Errorf("Stream = %v, %v, want [3 4], true", got, ok)
+	}
+	if got, ok := stream(l, 4); len(got) != 0 || ok {
+		t.Errorf("Stream after failed seek = %v, %v, want nothing, false", got, ok)
+	}
+	if l.Err() == nil {
+		t.Error("Err = nil after failed seek")
+	}
+}
+
+func TestABLoopClear(t *testing.T) {
+	src := &counter{len: 20}
+	l := &abLoop{s: src, a: 2, b: 5, hasA: true, enabled: true}
+	if got, _ := stream(l, 7); !reflect.DeepEqual(got, []float64{0, 1, 2, 3, 4, 2, 3}) {
+		t.Fatalf("Stream = %v", got)
+	}
+
+	l.clear()
+	if l.hasA || l.enabled || l.s != src {
+		t.Errorf("after clear: %+v", *l)
+	}
+	if got, _ := stream(l, 4); !reflect.DeepEqual(got, []float64{4, 5, 6, 7}) {
+		t.Errorf("Stream after clear = %v, want [4 5 6 7]", got)
+	}
+}
+
+func TestSetLoopUsesHeardPosition(t *testing.T) {
+	// The source runs at half the output rate, so the 100 ms speaker
+	// buffer holds 2205 source samples
+	src := &counter{len: 100000}
+	p := &Player{
+		sr:       44100,
+		format:   beep.Format{SampleRate: 22050},
+		streamer: src,
+		loop:     &abLoop{s: src},
+		bufSize:  4410,
+		seekTo:   -1,
+	}
+
+	src.pos = 12205
+	p.SetLoopA()
+	src.pos = 1000 // not after A once the buffer is accounted for
+	if p.SetLoopB() {
+		t.Error("SetLoopB accepted a point before A")
+	}
+	p.seekTo = 30000 // a pending seek is what will be heard next
+	if !p.SetLoopB() {
+		t.Fatal("SetLoopB failed")
+	}
+	if p.loop.a != 10000 || p.loop.b != 30000 || !p.loop.enabled {
+		t.Errorf("loop = %+v, want a 10000, b 30000, enabled", *p.loop)
+	}
+
+	p.ClearLoop()
+	if _, _, hasA, active := p.Loop(); hasA || active {
+		t.Errorf("after ClearLoop: hasA %v, active %v", hasA, active)
+	}
+}
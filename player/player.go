@@ -1,12 +1,12 @@
 package player
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -25,14 +25,20 @@ var EQFreqs = [10]float64{70, 180, 320, 600, 1000, 3000, 6000, 12000, 14000, 160
 
 // Player is the audio engine managing the playback pipeline:
 //
-//	[MP3 Decode] -> [Resample] -> [10x Biquad EQ] -> [Volume] -> [Tap] -> [Ctrl] -> [Speaker]
+//	[MP3 Decode] -> [A-B Loop] -> [Resample] -> [10x Biquad EQ] -> [Volume] -> [Ramp] -> [Tap] -> [Ctrl] -> [Speaker]
 type Player struct {
 	mu        sync.Mutex
 	sr        beep.SampleRate
 	streamer  beep.StreamSeekCloser
 	format    beep.Format
 	ctrl      *beep.Ctrl
-	volume    float64 // dB, range [-30, +6]
+	loop      *abLoop
+	ramp      *ramp
+	fadeTime  atomic.Int64 // ramp length in nanoseconds for pause/stop/seek fades
+	seekTo    int          // pending seek target in source samples, -1 if none
+	bufSize   int          // speaker buffer length in output samples
+	volume    float64      // dB, range [-30, +6]
+	fade      float64      // linear gain for fade-outs, range [0, 1]
 	eqBands   [10]float64
 	tap       *Tap
 	trackDone atomic.Bool
@@ -41,21 +47,30 @@ type Player struct {
 	rc        io.ReadCloser
 }
 
+// DefaultFadeTime is the default length of the click-free ramps applied
+// around pause, resume, stop, seek and track changes.
+const DefaultFadeTime = 20 * time.Millisecond
+
 // New creates a Player and initializes the speaker at the given sample rate.
 func New(sr beep.SampleRate) *Player {
-	speaker.Init(sr, sr.N(time.Second/10))
-	return &Player{sr: sr}
+	bufSize := sr.N(time.Second / 10)
+	speaker.Init(sr, bufSize)
+	p := &Player{sr: sr, fade: 1, seekTo: -1, bufSize: bufSize}
+	p.fadeTime.Store(int64(DefaultFadeTime))
+	return p
 }
 
 // Play opens and starts playing an audio file, building the full audio pipeline.
-// Supported formats: MP3, WAV, FLAC, OGG Vorbis.
+// Supported formats: MP3, WAV, FLAC, Ogg Vorbis, and with ffmpeg, AAC, MP4,
+// Opus, Ogg FLAC and WMA. The format is detected from the content.
 func (p *Player) Play(path string) error {
 	p.Stop()
 
 	var rc io.ReadCloser
+	var contentType string
 	var err error
 
-	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+	if isURL(path) {
 		resp, err := http.Get(path)
 		if err != nil {
 			return fmt.Errorf("http get: %w", err)
@@ -65,6 +80,7 @@ func (p *Player) Play(path string) error {
 			return fmt.Errorf("http stream failed: %s", resp.Status)
 		}
 		rc = resp.Body
+		contentType = resp.Header.Get("Content-Type")
 	} else {
 		rc, err = os.Open(path)
 		if err != nil {
@@ -72,7 +88,7 @@ func (p *Player) Play(path string) error {
 		}
 	}
 
-	streamer, format, err := decode(rc, path, p.sr)
+	streamer, format, err := decode(rc, path, contentType, p.sr)
 	if err != nil {
 		rc.Close()
 		return fmt.Errorf("decode: %w", err)
@@ -84,7 +100,9 @@ func (p *Player) Play(path string) error {
 	p.format = format
 	p.trackDone.Store(false)
 
-	var s beep.Streamer = streamer
+	// A-B loop operates on source samples, ahead of resampling
+	p.loop = &abLoop{s: streamer}
+	var s beep.Streamer = p.loop
 
 	// Resample to target sample rate if needed
 	if format.SampleRate != p.sr {
@@ -97,10 +115,15 @@ func (p *Player) Play(path string) error {
 	}
 
 	// Volume control
-	s = &volumeStreamer{s: s, vol: &p.volume, mu: &p.mu}
+	s = &volumeStreamer{s: s, vol: &p.volume, fade: &p.fade, last: p.fade, mu: &p.mu}
+
+	// Fade in from silence to avoid a click at the start of the track
+	p.ramp = &ramp{s: s}
+	p.ramp.fadeTo(1, p.rampSamples(), nil)
+	p.seekTo = -1
 
 	// Tap for FFT visualization
-	p.tap = NewTap(s, 4096)
+	p.tap = NewTap(p.ramp, 4096)
 
 	// Pause/resume control
 	p.ctrl = &beep.Ctrl{Streamer: p.tap}
@@ -117,18 +140,64 @@ func (p *Player) Play(path string) error {
 	return nil
 }
 
-// TogglePause toggles between paused and playing states.
+// TogglePause toggles between paused and playing states. Playback fades out
+// before pausing and fades back in on resume.
 func (p *Player) TogglePause() {
 	speaker.Lock()
 	defer speaker.Unlock()
-	if p.ctrl != nil {
-		p.ctrl.Paused = !p.ctrl.Paused
-		p.paused = p.ctrl.Paused
+	if p.ctrl == nil {
+		return
+	}
+	n := p.rampSamples()
+	if p.paused {
+		p.ctrl.Paused = false
+		p.ramp.fadeTo(1, n, nil)
+	} else {
+		ctrl := p.ctrl
+		p.ramp.fadeTo(0, n, func() {
+			p.applyPendingSeek()
+			ctrl.Paused = true
+		})
+		if n == 0 {
+			ctrl.Paused = true
+		}
+	}
+	p.paused = !p.paused
+}
+
+// SetFadeTime sets the length of the fade ramps around pause, resume, stop,
+// seek and track changes. Zero disables fading.
+func (p *Player) SetFadeTime(d time.Duration) {
+	p.fadeTime.Store(int64(max(d, 0)))
+}
+
+// rampSamples returns the fade ramp length in output samples.
+func (p *Player) rampSamples() int {
+	return p.sr.N(time.Duration(p.fadeTime.Load()))
+}
+
+// fadeOut ramps the current track down to silence and waits for it to
+// finish so that Stop does not cut the waveform mid-cycle.
+func (p *Player) fadeOut() {
+	speaker.Lock()
+	n := p.rampSamples()
+	if p.ramp == nil || p.paused || p.ramp.silent() || p.trackDone.Load() || n == 0 {
+		speaker.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	p.ramp.fadeTo(0, n, func() { close(done) })
+	speaker.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(p.sr.D(n) + 100*time.Millisecond):
 	}
 }
 
 // Stop halts playback and releases resources.
 func (p *Player) Stop() {
+	p.fadeOut()
 	speaker.Clear()
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -141,6 +210,9 @@ func (p *Player) Stop() {
 		p.rc = nil
 	}
 	p.ctrl = nil
+	p.loop = nil
+	p.ramp = nil
+	p.seekTo = -1
 	p.tap = nil
 	p.playing = false
 	p.paused = false
@@ -155,6 +227,9 @@ func (p *Player) Seek(d time.Duration) error {
 		return nil
 	}
 	curSample := p.streamer.Position()
+	if p.seekTo >= 0 {
+		curSample = p.seekTo
+	}
 	curDur := p.format.SampleRate.D(curSample)
 	newSample := p.format.SampleRate.N(curDur + d)
 	if newSample < 0 {
@@ -163,7 +238,108 @@ func (p *Player) Seek(d time.Duration) error {
 	if newSample >= p.streamer.Len() {
 		newSample = p.streamer.Len() - 1
 	}
-	return p.streamer.Seek(newSample)
+	return p.seekSample(newSample)
+}
+
+// SeekTo moves the playback position to an absolute offset from the start of the track.
+func (p *Player) SeekTo(pos time.Duration) error {
+	speaker.Lock()
+	defer speaker.Unlock()
+	if p.streamer == nil {
+		return nil
+	}
+	n := max(0, min(p.format.SampleRate.N(pos), p.streamer.Len()-1))
+	return p.seekSample(n)
+}
+
+// seekSample moves the decoder to source sample n. While audible, the jump
+// happens at the bottom of a fade-out and playback fades back in afterwards.
+// The caller must hold the speaker lock.
+func (p *Player) seekSample(n int) error {
+	ramp := p.ramp
+	length := p.rampSamples()
+	if ramp == nil || p.paused || length == 0 {
+		p.seekTo = -1
+		return p.streamer.Seek(n)
+	}
+	p.seekTo = n
+	ramp.fadeTo(0, length, func() {
+		p.applyPendingSeek()
+		ramp.fadeTo(1, length, nil)
+	})
+	return nil
+}
+
+// applyPendingSeek performs a seek deferred by seekSample.
+// The caller must hold the speaker lock.
+func (p *Player) applyPendingSeek() {
+	if p.seekTo < 0 || p.streamer == nil {
+		return
+	}
+	p.streamer.Seek(p.seekTo)
+	p.seekTo = -1
+}
+
+// SetLoopA marks the current position as the start of the A-B loop.
+// Any previously set end point is cleared.
+func (p *Player) SetLoopA() {
+	speaker.Lock()
+	defer speaker.Unlock()
+	if p.loop == nil {
+		return
+	}
+	p.loop.a = p.heardSample()
+	p.loop.hasA = true
+	p.loop.enabled = false
+}
+
+// SetLoopB marks the current position as the end of the A-B loop and starts
+// looping. Returns false if A is not set or the position is not after A.
+func (p *Player) SetLoopB() bool {
+	speaker.Lock()
+	defer speaker.Unlock()
+	if p.loop == nil || !p.loop.hasA {
+		return false
+	}
+	b := p.heardSample()
+	if b <= p.loop.a {
+		return false
+	}
+	p.loop.b = b
+	p.loop.enabled = true
+	return true
+}
+
+// ClearLoop removes both A-B loop points.
+func (p *Player) ClearLoop() {
+	speaker.Lock()
+	defer speaker.Unlock()
+	if p.loop != nil {
+		p.loop.clear()
+	}
+}
+
+// heardSample returns the source sample being heard: the target of a
+// pending seek, or the decoder position less what the speaker has yet to
+// play. The caller must hold the speaker lock.
+func (p *Player) heardSample() int {
+	if p.seekTo >= 0 {
+		return p.seekTo
+	}
+	buffered := p.format.SampleRate.N(p.sr.D(p.bufSize))
+	return max(p.streamer.Position()-buffered, 0)
+}
+
+// Loop returns the A-B loop points. hasA reports whether A is set and
+// active reports whether playback is currently looping between A and B.
+func (p *Player) Loop() (a, b time.Duration, hasA, active bool) {
+	speaker.Lock()
+	defer speaker.Unlock()
+	if p.loop == nil {
+		return 0, 0, false, false
+	}
+	sr := p.format.SampleRate
+	return sr.D(p.loop.a), sr.D(p.loop.b), p.loop.hasA, p.loop.enabled
 }
 
 // Position returns the current playback position.
@@ -173,6 +349,9 @@ func (p *Player) Position() time.Duration {
 	if p.streamer == nil {
 		return 0
 	}
+	if p.seekTo >= 0 {
+		return p.format.SampleRate.D(p.seekTo)
+	}
 	return p.format.SampleRate.D(p.streamer.Position())
 }
 
@@ -200,6 +379,15 @@ func (p *Player) Volume() float64 {
 	return p.volume
 }
 
+// SetFade sets an additional linear gain in [0, 1] applied on top of the
+// volume, used for gradual fade-outs such as the sleep timer. Changes are
+// ramped across the next audio buffer to avoid zipper noise.
+func (p *Player) SetFade(gain float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fade = max(min(gain, 1), 0)
+}
+
 // SetEQBand sets a single EQ band's gain in dB, clamped to [-12, +12].
 func (p *Player) SetEQBand(band int, dB float64) {
 	if band < 0 || band >= 10 {
@@ -252,52 +440,74 @@ func (p *Player) Close() {
 	p.Stop()
 }
 
-// needsFFmpeg reports whether the given extension requires ffmpeg to decode.
-func needsFFmpeg(ext string) bool {
-	switch ext {
-	case ".m4a", ".aac", ".m4b", ".alac", ".wma", ".opus":
-		return true
-	}
-	return false
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
 }
 
-// decode selects the appropriate decoder based on the file extension.
-func decode(rc io.ReadCloser, path string, sr beep.SampleRate) (beep.StreamSeekCloser, beep.Format, error) {
-	ext := strings.ToLower(filepath.Ext(path))
-	if strings.Contains(path, "stream.view") || strings.Contains(path, "format=mp3") {
-		ext = ".mp3"
-	}
-	if needsFFmpeg(ext) {
-		return decodeFFmpeg(path, sr)
-	}
-	switch ext {
-	case ".wav":
-		return wav.Decode(rc)
-	case ".flac":
-		return flac.Decode(rc)
-	case ".ogg":
-		return vorbis.Decode(rc)
+// decode selects a decoder from the content of the file or stream, using
+// the Content-Type header and file extension only as hints when the
+// content is not recognized.
+func decode(rc io.ReadCloser, path, contentType string, sr beep.SampleRate) (beep.StreamSeekCloser, beep.Format, error) {
+	head, r := peekHead(bufio.NewReaderSize(rc, sniffLen))
+	rc = readCloser{r, rc}
+
+	format := detectFormat(head, path, contentType)
+	var (
+		s   beep.StreamSeekCloser
+		f   beep.Format
+		err error
+	)
+	switch format {
+	case formatMP3:
+		s, f, err = mp3.Decode(rc)
+	case formatFLAC:
+		s, f, err = flac.Decode(rc)
+	case formatVorbis:
+		s, f, err = vorbis.Decode(rc)
+	case formatWAV:
+		s, f, err = wav.Decode(rc)
+	case formatAAC, formatMP4, formatOpus, formatOggFLAC, formatWMA:
+		return decodeFFmpeg(path, format, sr)
 	default:
-		return mp3.Decode(rc)
+		return nil, beep.Format{}, unsupportedError(format, head, path, contentType)
+	}
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("%s: %w", format, err)
 	}
+	return s, f, nil
 }
 
-// volumeStreamer applies dB gain to an audio stream.
+// readCloser reads through a buffered reader and closes the underlying
+// stream.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// volumeStreamer applies dB gain and a linear fade to an audio stream.
 type volumeStreamer struct {
-	s   beep.Streamer
-	vol *float64
-	mu  *sync.Mutex
+	s    beep.Streamer
+	vol  *float64
+	fade *float64
+	last float64 // fade applied at the end of the previous buffer
+	mu   *sync.Mutex
 }
 
 func (v *volumeStreamer) Stream(samples [][2]float64) (int, bool) {
 	n, ok := v.s.Stream(samples)
 	v.mu.Lock()
 	gain := math.Pow(10, *v.vol/20)
+	fade := *v.fade
 	v.mu.Unlock()
+
+	// Ramp linearly from the previous fade level to the new one
+	step := (fade - v.last) / float64(max(n, 1))
 	for i := range n {
-		samples[i][0] *= gain
-		samples[i][1] *= gain
+		g := gain * (v.last + step*float64(i+1))
+		samples[i][0] *= g
+		samples[i][1] *= g
 	}
+	v.last = fade
 	return n, ok
 }
 
@@ -0,0 +1,62 @@
+package player
+
+import "github.com/gopxl/beep/v2"
+
+// ramp applies short linear gain ramps so that pausing, seeking and stopping
+// never cut the waveform mid-cycle, which would otherwise be audible as a
+// click. All fields are guarded by the speaker lock.
+type ramp struct {
+	s      beep.Streamer
+	gain   float64 // current gain in [0, 1]
+	target float64 // gain being ramped towards
+	step   float64 // gain change per sample
+	done   func()  // runs once when a fade-out reaches silence
+}
+
+// fadeTo starts ramping towards target over length samples. done, if not nil,
+// runs from within Stream once the ramp reaches zero gain; it may start
+// another ramp. A new call replaces any pending done callback.
+func (r *ramp) fadeTo(target float64, length int, done func()) {
+	r.target = target
+	r.done = done
+	if length <= 0 {
+		r.gain = target
+		r.step = 1
+		return
+	}
+	r.step = 1 / float64(length)
+}
+
+// silent reports whether the ramp has fully faded out.
+func (r *ramp) silent() bool {
+	return r.gain == 0 && r.target == 0
+}
+
+func (r *ramp) Stream(samples [][2]float64) (int, bool) {
+	n, ok := r.s.Stream(samples)
+	for i := 0; i < n; i++ {
+		switch {
+		case r.gain < r.target:
+			r.gain = min(r.gain+r.step, r.target)
+		case r.gain > r.target:
+			r.gain = max(r.gain-r.step, r.target)
+		}
+		samples[i][0] *= r.gain
+		samples[i][1] *= r.gain
+
+		if r.gain == 0 && r.done != nil {
+			done := r.done
+			r.done = nil
+			done()
+			// The callback resumed playback (e.g. after a seek); refill the
+			// rest of the buffer from the new position instead of leaving a gap.
+			if r.target > 0 && i+1 < n {
+				m, _ := r.s.Stream(samples[i+1 : n])
+				n, ok = i+1+m, true
+			}
+		}
+	}
+	return n, ok
+}
+
+func (r *ramp) Err() error { return r.s.Err() }
@@ -0,0 +1,197 @@
+package player
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/speaker"
+)
+
+// ones is an endless source at full scale, so the output is the gain.
+var ones = beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+	for i := range samples {
+		samples[i] = [2]float64{1, 1}
+	}
+	return len(samples), true
+})
+
+func TestRampGain(t *testing.T) {
+	tests := []struct {
+		name   string
+		gain   float64
+		target float64
+		length int
+		want   []float64
+	}{
+		{"fade in", 0, 1, 4, []float64{0.25, 0.5, 0.75, 1, 1, 1}},
+		{"fade out", 1, 0, 4, []float64{0.75, 0.5, 0.25, 0, 0, 0}},
+		{"partial fade out", 0.5, 0, 4, []float64{0.25, 0, 0}},
+		{"instant fade in", 0, 1, 0, []float64{1, 1, 1}},
+		{"instant fade out", 1, 0, 0, []float64{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		r := &ramp{s: ones, gain: tt.gain}
+		r.fadeTo(tt.target, tt.length, nil)
+		if got, _ := stream(r, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: gain = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRampDone(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		n      int // samples streamed before done should run
+	}{
+		{"fade", 4, 4},
+		{"instant", 0, 1},
+	}
+	for _, tt := range tests {
+		calls := 0
+		r := &ramp{s: ones, gain: 1}
+		r.fadeTo(0, tt.length, func() { calls++ })
+		stream(r, tt.n-1)
+		if calls != 0 {
+			t.Errorf("%s: done ran before reaching silence", tt.name)
+		}
+		stream(r, 1)
+		stream(r, 8)
+		if calls != 1 {
+			t.Errorf("%s: done ran %d times, want once", tt.name, calls)
+		}
+		if !r.silent() {
+			t.Errorf("%s: not silent after fading out", tt.name)
+		}
+	}
+}
+
+func TestRampRefillsAfterDone(t *testing.T) {
+	// Like a seek: at silence the source jumps ahead and fades back in, and
+	// the rest of the buffer is filled from the new position
+	src := &counter{len: 1000}
+	r := &ramp{s: src, gain: 1}
+	r.fadeTo(0, 2, func() {
+		src.Seek(100)
+		r.fadeTo(1, 2, nil)
+	})
+	got, ok := stream(r, 6)
+	if want := []float64{0, 0, 50, 101, 102, 103}; !reflect.DeepEqual(got, want) || !ok {
+		t.Errorf("Stream = %v, %v, want %v, true", got, ok, want)
+	}
+	if src.pos != 104 {
+		t.Errorf("source at %d, want 104", src.pos)
+	}
+}
+
+// testPlayer returns a player streaming a counter at 1 kHz, whose fades
+// take fade samples, and the counter.
+func testPlayer(fade int) (*Player, *counter) {
+	src := &counter{len: 1000}
+	p := &Player{sr: 1000, format: beep.Format{SampleRate: 1000}, streamer: src, fade: 1, seekTo: -1, playing: true}
+	p.loop = &abLoop{s: src}
+	p.ramp = &ramp{s: p.loop, gain: 1, target: 1}
+	p.ctrl = &beep.Ctrl{Streamer: p.ramp}
+	p.SetFadeTime(time.Duration(fade) * time.Millisecond)
+	return p, src
+}
+
+func TestSeekFades(t *testing.T) {
+	p, src := testPlayer(4)
+	if err := p.SeekTo(500 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if src.pos != 0 || p.Position() != 500*time.Millisecond {
+		t.Errorf("pending seek: source at %d, Position %v", src.pos, p.Position())
+	}
+	// A second seek while fading replaces the target
+	p.Seek(100 * time.Millisecond)
+
+	got, _ := stream(p.ctrl, 8)
+	if want := []float64{0, 0.5, 0.5, 0, 150, 300.5, 451.5, 603}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Stream = %v, want %v", got, want)
+	}
+	if p.seekTo != -1 || src.pos != 604 {
+		t.Errorf("after fade: seekTo %d, source at %d", p.seekTo, src.pos)
+	}
+}
+
+func TestSeekWithoutFade(t *testing.T) {
+	p, src := testPlayer(0)
+	if err := p.SeekTo(500 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if src.pos != 500 || p.seekTo != -1 {
+		t.Errorf("source at %d, seekTo %d, want an immediate seek", src.pos, p.seekTo)
+	}
+}
+
+func TestTogglePause(t *testing.T) {
+	tests := []struct {
+		name       string
+		fade       int
+		pausedNow  bool // ctrl paused before anything is streamed
+		fadeOutLen int  // samples streamed before ctrl pauses
+	}{
+		{"fade", 4, false, 4},
+		{"instant", 0, true, 0},
+	}
+	for _, tt := range tests {
+		p, _ := testPlayer(tt.fade)
+		p.TogglePause()
+		if !p.IsPaused() || p.ctrl.Paused != tt.pausedNow {
+			t.Errorf("%s: IsPaused %v, ctrl paused %v", tt.name, p.IsPaused(), p.ctrl.Paused)
+		}
+		if tt.fadeOutLen > 0 {
+			got, _ := stream(p.ctrl, tt.fadeOutLen)
+			if last := got[len(got)-1]; last != 0 || !p.ctrl.Paused {
+				t.Errorf("%s: last sample %v, ctrl paused %v after fading out", tt.name, last, p.ctrl.Paused)
+			}
+		}
+
+		p.TogglePause()
+		if p.IsPaused() || p.ctrl.Paused {
+			t.Errorf("%s: still paused after resuming", tt.name)
+		}
+		stream(p.ctrl, tt.fade)
+		if p.ramp.gain != 1 {
+			t.Errorf("%s: gain %v after fading back in", tt.name, p.ramp.gain)
+		}
+	}
+}
+
+func TestFadeOutWaits(t *testing.T) {
+	p, _ := testPlayer(4)
+	finished := make(chan struct{})
+	go func() {
+		p.fadeOut()
+		close(finished)
+	}()
+	for {
+		select {
+		case <-finished:
+			speaker.Lock()
+			defer speaker.Unlock()
+			if !p.ramp.silent() {
+				t.Error("fadeOut returned before the ramp reached silence")
+			}
+			return
+		default:
+			speaker.Lock()
+			stream(p.ctrl, 1)
+			speaker.Unlock()
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestFadeOutWithoutFade(t *testing.T) {
+	p, _ := testPlayer(0)
+	start := time.Now()
+	p.fadeOut()
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("fadeOut took %v with fading disabled", d)
+	}
+}
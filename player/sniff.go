@@ -0,0 +1,260 @@
+package player
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how many bytes of a file or stream are inspected to
+// recognize it. It covers a first Ogg page and small ID3 tags.
+const sniffLen = 4096
+
+// Audio formats, named as they appear in error messages.
+const (
+	formatMP3     = "MP3"
+	formatAAC     = "AAC"
+	formatMP4     = "MP4/M4A"
+	formatFLAC    = "FLAC"
+	formatVorbis  = "Ogg Vorbis"
+	formatOpus    = "Ogg Opus"
+	formatOggFLAC = "Ogg FLAC"
+	formatWAV     = "WAV"
+	formatWMA     = "WMA"
+
+	// Recognized, but not playable.
+	formatOgg  = "Ogg with an unknown codec"
+	formatText = "text (not audio)"
+)
+
+// extFormats maps file extensions to the format they usually hold. The
+// extension is only used when the content itself is not recognized.
+var extFormats = map[string]string{
+	".mp3":  formatMP3,
+	".aac":  formatAAC,
+	".m4a":  formatMP4,
+	".m4b":  formatMP4,
+	".mp4":  formatMP4,
+	".alac": formatMP4,
+	".flac": formatFLAC,
+	".ogg":  formatVorbis,
+	".oga":  formatVorbis,
+	".opus": formatOpus,
+	".wav":  formatWAV,
+	".wma":  formatWMA,
+}
+
+// asfGUID starts every ASF (WMA) file.
+var asfGUID = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}
+
+// sniffFormat recognizes audio by its first bytes, or returns "" if the
+// content is unknown.
+func sniffFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return sniffID3(head)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return formatFLAC
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return sniffOgg(head)
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WAVE")):
+		return formatWAV
+	case len(head) >= 8 && bytes.Equal(head[4:8], []byte("ftyp")):
+		return formatMP4
+	case bytes.HasPrefix(head, asfGUID):
+		return formatWMA
+	}
+	if f := frameSync(head); f != "" {
+		return f
+	}
+	if isText(head) {
+		return formatText
+	}
+	return ""
+}
+
+// maxID3Size caps how much of an ID3v2 tag is read to look past it.
+const maxID3Size = 16 << 20
+
+// id3Size returns the length of the ID3v2 tag head starts with, including
+// its header and footer, or 0 if it does not start with one.
+func id3Size(head []byte) int {
+	if len(head) < 10 || !bytes.HasPrefix(head, []byte("ID3")) {
+		return 0
+	}
+	// The tag size is a 28-bit "syncsafe" integer, excluding the header
+	// and the optional footer.
+	size := int(head[6]&0x7f)<<21 | int(head[7]&0x7f)<<14 | int(head[8]&0x7f)<<7 | int(head[9]&0x7f)
+	size += 10
+	if head[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+// sniffID3 looks past an ID3v2 tag to tell MP3 from AAC or FLAC. head must
+// extend past the tag (see peekHead); a file that ends within its tag is
+// not recognized.
+func sniffID3(head []byte) string {
+	size := id3Size(head)
+	if size == 0 || size+2 > len(head) {
+		return ""
+	}
+	if f := sniffFormat(head[size:]); f != "" && f != formatText {
+		return f
+	}
+	return formatMP3
+}
+
+// peekHead returns the first bytes of br for sniffing and a reader that
+// still yields all of br. The head extends past an ID3v2 tag that is
+// larger than sniffLen, e.g. one with embedded cover art.
+func peekHead(br *bufio.Reader) ([]byte, io.Reader) {
+	head, _ := br.Peek(sniffLen)
+	size := id3Size(head)
+	if size+2 <= len(head) || size > maxID3Size {
+		return head, br
+	}
+	buf := make([]byte, size+sniffLen)
+	n, _ := io.ReadFull(br, buf)
+	return buf[:n], io.MultiReader(bytes.NewReader(buf[:n]), br)
+}
+
+// frameSync recognizes the header of an MPEG audio frame or an ADTS
+// (raw AAC) frame, which share the same 12-bit sync word.
+func frameSync(b []byte) string {
+	if len(b) < 2 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return ""
+	}
+	if b[1]&0x06 == 0 { // layer 0 is reserved for MPEG audio and used by ADTS
+		if b[1]&0xF0 == 0xF0 {
+			return formatAAC
+		}
+		return ""
+	}
+	if b[1]&0x18 == 0x08 { // reserved MPEG version
+		return ""
+	}
+	return formatMP3
+}
+
+// sniffOgg identifies the codec of an Ogg stream from the first packet of
+// its first page.
+func sniffOgg(head []byte) string {
+	// Page header: 27 bytes, the last of which counts the segment table
+	// entries that precede the packet data.
+	if len(head) < 27 {
+		return formatOgg
+	}
+	start := 27 + int(head[26])
+	if start >= len(head) {
+		return formatOgg
+	}
+	packet := head[start:]
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return formatVorbis
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		return formatOpus
+	case bytes.HasPrefix(packet, []byte("\x7fFLAC")):
+		return formatOggFLAC
+	}
+	return formatOgg
+}
+
+// isText reports whether head looks like text, e.g. an HTML error page
+// served in place of a stream.
+func isText(head []byte) bool {
+	head = head[:min(len(head), 32)]
+	if len(head) == 0 {
+		return false
+	}
+	for _, b := range head {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' || b >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// formatFromContentType maps a stream's MIME type to an audio format, or
+// returns "" if the type is missing or too generic (e.g.
+// application/octet-stream).
+func formatFromContentType(contentType string) string {
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch mt {
+	case "audio/mpeg", "audio/mp3", "audio/mpeg3", "audio/x-mpeg", "audio/x-mp3":
+		return formatMP3
+	case "audio/flac", "audio/x-flac":
+		return formatFLAC
+	case "audio/wav", "audio/wave", "audio/x-wav", "audio/vnd.wave":
+		return formatWAV
+	case "audio/opus":
+		return formatOpus
+	case "audio/ogg", "application/ogg", "audio/vorbis", "audio/x-vorbis+ogg":
+		if strings.Contains(params["codecs"], "opus") {
+			return formatOpus
+		}
+		return formatVorbis
+	case "audio/aac", "audio/aacp":
+		return formatAAC
+	case "audio/mp4", "audio/m4a", "audio/x-m4a":
+		return formatMP4
+	case "audio/x-ms-wma":
+		return formatWMA
+	}
+	return ""
+}
+
+// pathExt returns the lowercased extension of a file path or of the path
+// component of a URL.
+func pathExt(path string) string {
+	if isURL(path) {
+		if u, err := url.Parse(path); err == nil {
+			path = u.Path
+		}
+	}
+	return strings.ToLower(filepath.Ext(path))
+}
+
+// detectFormat picks the format of a file or stream: its content decides,
+// then the Content-Type header of a stream, then the file extension.
+func detectFormat(head []byte, path, contentType string) string {
+	if len(head) == 0 {
+		return ""
+	}
+	if f := sniffFormat(head); f != "" {
+		return f
+	}
+	if f := formatFromContentType(contentType); f != "" {
+		return f
+	}
+	return extFormats[pathExt(path)]
+}
+
+// unsupportedError describes why no decoder could be chosen.
+func unsupportedError(format string, head []byte, path, contentType string) error {
+	var what []string
+	if format != "" {
+		what = append(what, "detected "+format)
+	} else if len(head) == 0 {
+		what = append(what, "empty file")
+	} else {
+		what = append(what, fmt.Sprintf("unrecognized content starting with % x", head[:min(len(head), 8)]))
+	}
+	if contentType != "" {
+		what = append(what, "Content-Type "+contentType)
+	}
+	if ext := pathExt(path); ext != "" {
+		what = append(what, "extension "+ext)
+	}
+	return fmt.Errorf("unsupported format (%s)", strings.Join(what, ", "))
+}
@@ -0,0 +1,100 @@
+package player
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+// id3 returns an ID3v2.4 tag whose frames take size bytes.
+func id3(size int) []byte {
+	tag := []byte{'I', 'D', '3', 4, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(tag, make([]byte, size)...)
+}
+
+// oggPage returns the start of an Ogg page whose first packet begins with
+// packet.
+func oggPage(packet string) []byte {
+	page := append([]byte("OggS"), make([]byte, 22)...)
+	page = append(page, 1, byte(len(packet)))
+	return append(page, packet...)
+}
+
+func cat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+var (
+	mp3Frame  = []byte{0xFF, 0xFB, 0x90, 0x64}
+	adtsFrame = []byte{0xFF, 0xF1, 0x50, 0x80}
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		head        []byte
+		path        string
+		contentType string
+		want        string
+	}{
+		{"id3 mp3", cat(id3(100), mp3Frame), "", "", formatMP3},
+		{"id3 adts", cat(id3(100), adtsFrame), "", "", formatAAC},
+		{"id3 flac", cat(id3(100), []byte("fLaC\x00\x00\x00\x22")), "", "", formatFLAC},
+		{"id3 with footer", cat([]byte("ID3\x04\x00\x10\x00\x00\x00\x04"), make([]byte, 14), adtsFrame), "", "", formatAAC},
+		{"id3 padding only", cat(id3(100), make([]byte, 8)), "", "", formatMP3},
+		{"truncated id3", id3(100)[:50], "a.m4a", "", formatMP4},
+		{"bare mp3", mp3Frame, "", "", formatMP3},
+		{"bare adts", adtsFrame, "", "", formatAAC},
+		{"reserved mpeg version", []byte{0xFF, 0xEB, 0x90, 0x64}, "", "", ""},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), "", "", formatFLAC},
+		{"ogg vorbis", oggPage("\x01vorbis"), "", "", formatVorbis},
+		{"ogg opus", oggPage("OpusHead"), "", "", formatOpus},
+		{"ogg flac", oggPage("\x7fFLAC"), "", "", formatOggFLAC},
+		{"ogg unknown", oggPage("\x80theora"), "", "", formatOgg},
+		{"short ogg", []byte("OggS\x00"), "", "", formatOgg},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "", "", formatWAV},
+		{"riff avi", []byte("RIFF\x24\x00\x00\x00AVI LIST"), "", "", ""},
+		{"mp4", []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00"), "", "", formatMP4},
+		{"asf", append(asfGUID, 0x11, 0xA6, 0xD9, 0x00), "", "", formatWMA},
+		{"html", []byte("<!DOCTYPE html><html><head>"), "a.mp3", "text/html", formatText},
+		{"text", []byte("404 page not found\n"), "", "", formatText},
+		{"empty", nil, "a.mp3", "audio/mpeg", ""},
+		{"content type", []byte{0, 1, 2, 3}, "a.mp3", "audio/ogg; codecs=opus", formatOpus},
+		{"generic content type", []byte{0, 1, 2, 3}, "https://s.example/live.aac?x=1", "application/octet-stream", formatAAC},
+		{"extension", []byte{0, 1, 2, 3}, "/music/A.FLAC", "", formatFLAC},
+		{"unknown", []byte{0, 1, 2, 3}, "/music/a.txt", "", ""},
+	}
+	for _, tt := range tests {
+		if got := detectFormat(tt.head, tt.path, tt.contentType); got != tt.want {
+			t.Errorf("%s: detectFormat = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPeekHeadPastLargeID3(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"small tag", cat(id3(100), adtsFrame), formatAAC},
+		{"large tag", cat(id3(3*sniffLen), adtsFrame, make([]byte, 1000)), formatAAC},
+		{"large tag mp3", cat(id3(3*sniffLen), mp3Frame), formatMP3},
+		{"file ends in tag", id3(3 * sniffLen)[:2*sniffLen], ""},
+	}
+	for _, tt := range tests {
+		head, r := peekHead(bufio.NewReaderSize(bytes.NewReader(tt.data), sniffLen))
+		if got := detectFormat(head, "", ""); got != tt.want {
+			t.Errorf("%s: detectFormat = %q, want %q", tt.name, got, tt.want)
+		}
+		rest, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rest, tt.data) {
+			t.Errorf("%s: reader yields %d bytes, want all %d", tt.name, len(rest), len(tt.data))
+		}
+	}
+}
@@ -33,6 +33,32 @@ type Track struct {
 	Path   string
 	Title  string
 	Artist string
+	Album  string
+	ID     string // provider-specific track ID, empty for local files
+
+	// Provider is the name of the provider the track came from, empty for
+	// local files.
+	Provider string
+
+	// Fallback is an alternative stream tried if Path cannot be played,
+	// e.g. an MP3 transcode of an original the player cannot decode.
+	Fallback string
+
+	Starred bool // marked as a favorite on the provider
+	Rating  int  // provider rating 1-5, 0 if unrated
+}
+
+// Key returns a stable identifier for the track. Provider tracks are keyed
+// by provider name and ID, as "Provider:ID", since their stream URLs carry
+// per-request auth parameters and IDs are only unique within a provider.
+func (t Track) Key() string {
+	switch {
+	case t.ID != "" && t.Provider != "":
+		return t.Provider + ":" + t.ID
+	case t.ID != "":
+		return t.ID
+	}
+	return t.Path
 }
 
 // TrackFromPath creates a Track by parsing the filename.
@@ -47,6 +73,24 @@ func TrackFromPath(path string) Track {
 	return Track{Path: path, Title: name}
 }
 
+// SameAlbum reports whether two tracks belong to the same album. Tracks
+// without album metadata are grouped by their containing directory.
+func (t Track) SameAlbum(o Track) bool {
+	if t.Album != "" || o.Album != "" {
+		return t.Album == o.Album
+	}
+	if t.isRemote() || o.isRemote() {
+		return false
+	}
+	return filepath.Dir(t.Path) == filepath.Dir(o.Path)
+}
+
+// isRemote reports whether the track is streamed rather than a local file.
+// Provider tracks restored from a session have no URL until played.
+func (t Track) isRemote() bool {
+	return t.ID != "" || strings.HasPrefix(t.Path, "http://") || strings.HasPrefix(t.Path, "https://")
+}
+
 // DisplayName returns a formatted display string for the track.
 func (t Track) DisplayName() string {
 	if t.Artist != "" {
@@ -137,6 +181,26 @@ func (p *Playlist) Next() (Track, bool) {
 	return Track{}, false
 }
 
+// PeekNext returns the track Next would advance to without changing position.
+// With shuffle and RepeatAll the wrap-around track is not known in advance,
+// so the first track of the current order is returned.
+func (p *Playlist) PeekNext() (Track, bool) {
+	if len(p.tracks) == 0 {
+		return Track{}, false
+	}
+	switch {
+	case len(p.queue) > 0:
+		return p.tracks[p.queue[0]], true
+	case p.repeat == RepeatOne:
+		return p.tracks[p.order[p.pos]], true
+	case p.pos+1 < len(p.order):
+		return p.tracks[p.order[p.pos+1]], true
+	case p.repeat == RepeatAll:
+		return p.tracks[p.order[0]], true
+	}
+	return Track{}, false
+}
+
 // Prev moves to the previous track. Wraps around with RepeatAll.
 func (p *Playlist) Prev() (Track, bool) {
 	p.queuedIdx = -1
@@ -197,6 +261,13 @@ func (p *Playlist) QueuePosition(trackIdx int) int {
 // QueueLen returns the number of tracks in the queue.
 func (p *Playlist) QueueLen() int { return len(p.queue) }
 
+// SetTrack replaces the track at index i, e.g. after its metadata changed.
+func (p *Playlist) SetTrack(i int, t Track) {
+	if i >= 0 && i < len(p.tracks) {
+		p.tracks[i] = t
+	}
+}
+
 // Tracks returns all tracks in the playlist.
 func (p *Playlist) Tracks() []Track { return p.tracks }
 
@@ -204,6 +275,9 @@ func (p *Playlist) Tracks() []Track { return p.tracks }
 // Uses Fisher-Yates shuffle, preserving the current track at position 0.
 func (p *Playlist) ToggleShuffle() {
 	p.shuffle = !p.shuffle
+	if len(p.tracks) == 0 {
+		return
+	}
 	if p.shuffle {
 		p.doShuffle()
 		return
@@ -239,6 +313,69 @@ func (p *Playlist) CycleRepeat() {
 	p.repeat = (p.repeat + 1) % 3
 }
 
+// State is a snapshot of a playlist's tracks, play order, position and
+// queue, used to restore a session.
+type State struct {
+	Tracks  []Track
+	Order   []int // track indices in play order
+	Pos     int   // current position in Order
+	Shuffle bool
+	Queue   []int // track indices queued to play next
+	Queued  int   // track index playing from the queue, -1 if none
+}
+
+// State returns a snapshot of the playlist.
+func (p *Playlist) State() State {
+	return State{
+		Tracks:  slices.Clone(p.tracks),
+		Order:   slices.Clone(p.order),
+		Pos:     p.pos,
+		Shuffle: p.shuffle,
+		Queue:   slices.Clone(p.queue),
+		Queued:  p.queuedIdx,
+	}
+}
+
+// Restore replaces the playlist's contents with a snapshot. An order that
+// does not cover every track is replaced by the sequential one, and
+// out-of-range indices are dropped.
+func (p *Playlist) Restore(s State) {
+	n := len(s.Tracks)
+	p.tracks = slices.Clone(s.Tracks)
+	p.shuffle = s.Shuffle
+	p.order = slices.Clone(s.Order)
+	if !isPermutation(p.order, n) {
+		p.order = make([]int, n)
+		for i := range p.order {
+			p.order[i] = i
+		}
+	}
+	p.pos = 0
+	if s.Pos >= 0 && s.Pos < n {
+		p.pos = s.Pos
+	}
+	p.queue = slices.DeleteFunc(slices.Clone(s.Queue), func(i int) bool { return i < 0 || i >= n })
+	p.queuedIdx = -1
+	if s.Queued >= 0 && s.Queued < n {
+		p.queuedIdx = s.Queued
+	}
+}
+
+// isPermutation reports whether order holds each of 0..n-1 exactly once.
+func isPermutation(order []int, n int) bool {
+	if len(order) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, i := range order {
+		if i < 0 || i >= n || seen[i] {
+			return false
+		}
+		seen[i] = true
+	}
+	return true
+}
+
 // Shuffled returns whether shuffle is enabled.
 func (p *Playlist) Shuffled() bool { return p.shuffle }
 
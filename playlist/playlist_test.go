@@ -0,0 +1,42 @@
+package playlist
+
+import "testing"
+
+func TestTrackKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		track Track
+		want  string
+	}{
+		{"local file", Track{Path: "/music/a.mp3"}, "/music/a.mp3"},
+		{"stream", Track{Path: "https://radio.example/live"}, "https://radio.example/live"},
+		{"provider track", Track{Path: "https://nd.example/rest/stream?id=42&t=x", ID: "42", Provider: "Navidrome"}, "Navidrome:42"},
+		{"restored provider track", Track{ID: "42", Provider: "Jellyfin"}, "Jellyfin:42"},
+		{"id without provider", Track{Path: "https://nd.example/rest/stream?id=42", ID: "42"}, "42"},
+	}
+	for _, tt := range tests {
+		if got := tt.track.Key(); got != tt.want {
+			t.Errorf("%s: Key = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSameAlbum(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Track
+		want bool
+	}{
+		{"same album", Track{Album: "X", Path: "/a/1.mp3"}, Track{Album: "X", Path: "/b/2.mp3"}, true},
+		{"different album", Track{Album: "X"}, Track{Album: "Y"}, false},
+		{"same directory", Track{Path: "/a/1.mp3"}, Track{Path: "/a/2.mp3"}, true},
+		{"different directory", Track{Path: "/a/1.mp3"}, Track{Path: "/b/2.mp3"}, false},
+		{"streams", Track{Path: "http://r.example/a"}, Track{Path: "http://r.example/b"}, false},
+		{"restored provider tracks", Track{ID: "1", Provider: "Plex"}, Track{ID: "2", Provider: "Plex"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.SameAlbum(tt.b); got != tt.want {
+			t.Errorf("%s: SameAlbum = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
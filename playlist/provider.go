@@ -1,5 +1,7 @@
 package playlist
 
+import "time"
+
 type PlaylistInfo struct {
 	ID         string
 	Name       string
@@ -15,3 +17,59 @@ type Provider interface {
 	//Local file or URL
 	Tracks(playlistID string) ([]Track, error)
 }
+
+// Scrobbler is implemented by providers that record plays server-side.
+type Scrobbler interface {
+	// Scrobble reports a play of the track with the given ID that started
+	// at the given time. With submission false the track is only
+	// announced as now playing.
+	Scrobble(id string, at time.Time, submission bool) error
+}
+
+// PlaybackReporter is implemented by providers that show the progress of
+// playback server-side, e.g. in a dashboard of active sessions.
+type PlaybackReporter interface {
+	// ReportPlayback reports the state of the track with the given ID,
+	// "playing", "paused" or "stopped", and its position.
+	ReportPlayback(id, state string, position time.Duration) error
+}
+
+// Entry is a node in a provider's library: either a container such as an
+// artist, album or playlist, or a playable track.
+type Entry struct {
+	ID    string
+	Name  string
+	Info  string // secondary detail, e.g. album count or year
+	Track *Track // set for playable tracks; nil for containers
+}
+
+// Browser is implemented by providers whose library can be browsed
+// hierarchically, e.g. Artists → Albums → Tracks.
+type Browser interface {
+	// Browse returns the children of the container with the given ID.
+	// The empty ID is the root of the library.
+	Browse(id string) ([]Entry, error)
+}
+
+// Searcher is implemented by providers that can search their whole library.
+type Searcher interface {
+	// Search returns the artists, albums and tracks matching query.
+	Search(query string) ([]Entry, error)
+}
+
+// Rater is implemented by providers that store favorites and ratings.
+type Rater interface {
+	// SetStarred stars or unstars the track with the given ID.
+	SetStarred(id string, starred bool) error
+	// SetRating rates the track 1-5, or removes its rating with 0.
+	SetRating(id string, rating int) error
+}
+
+// Streamer is implemented by providers that can rebuild a track's stream
+// URLs from its ID, e.g. for tracks restored from a saved session, which
+// does not keep the credentials the URLs carry.
+type Streamer interface {
+	// StreamURLs returns the URL to play the track with the given ID and,
+	// if there is one, a fallback to try when it cannot be decoded.
+	StreamURLs(id string) (path, fallback string, err error)
+}
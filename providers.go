@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"cliamp/config"
+	"cliamp/external/jellyfin"
+	"cliamp/external/navidrome"
+	"cliamp/external/plex"
+	"cliamp/playlist"
+)
+
+// buildProviders creates a client for each configured media server,
+// resolving passwords from password commands or the keyring.
+func buildProviders(configs []config.ProviderConfig) ([]playlist.Provider, error) {
+	var providers []playlist.Provider
+	seen := make(map[string]bool)
+	for _, pc := range configs {
+		name := pc.DisplayName()
+		prov, err := buildProvider(pc)
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %w", name, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("provider %q: name is used twice; set a unique name", name)
+		}
+		seen[name] = true
+		providers = append(providers, prov)
+	}
+	return providers, nil
+}
+
+func buildProvider(pc config.ProviderConfig) (playlist.Provider, error) {
+	if pc.URL == "" {
+		return nil, errors.New("url is required")
+	}
+
+	switch pc.Type {
+	case config.ProviderNavidrome:
+		if pc.Format != "" && !slices.Contains(navidrome.Formats, pc.Format) {
+			return nil, fmt.Errorf("unknown format %q (want %s)", pc.Format, strings.Join(navidrome.Formats, ", "))
+		}
+		c := &navidrome.NavidromeClient{
+			Label:      pc.Name,
+			URL:        pc.URL,
+			User:       pc.User,
+			APIKey:     pc.APIKey,
+			LegacyAuth: pc.LegacyAuth,
+			Format:     pc.Format,
+			MaxBitRate: pc.MaxBitRate,
+		}
+		if c.APIKey == "" {
+			secret, err := pc.Secret()
+			if err != nil {
+				return nil, err
+			}
+			if c.User == "" || secret == "" {
+				return nil, errors.New("set user and password, password_command or keyring, or set api_key")
+			}
+			c.Password = secret
+		}
+		return c, nil
+
+	case config.ProviderJellyfin:
+		c := &jellyfin.JellyfinClient{
+			Label:      pc.Name,
+			URL:        pc.URL,
+			User:       pc.User,
+			APIKey:     pc.APIKey,
+			MaxBitRate: pc.MaxBitRate,
+		}
+		if c.APIKey == "" {
+			if c.User == "" {
+				return nil, errors.New("set user, or set api_key")
+			}
+			// Users without a password sign in with an empty one
+			secret, err := pc.Secret()
+			if err != nil {
+				return nil, err
+			}
+			c.Password = secret
+		}
+		return c, nil
+
+	case config.ProviderPlex:
+		token, err := pc.Secret()
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			return nil, errors.New("set token, password_command or keyring")
+		}
+		return &plex.PlexClient{Label: pc.Name, URL: pc.URL, Token: token}, nil
+
+	case "":
+		return nil, errors.New("type is required (navidrome, jellyfin or plex)")
+	}
+	return nil, fmt.Errorf("unknown type %q (want navidrome, jellyfin or plex)", pc.Type)
+}
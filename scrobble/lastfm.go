@@ -0,0 +1,162 @@
+package scrobble
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLastFMURL is the Last.fm API endpoint.
+const DefaultLastFMURL = "https://ws.audioscrobbler.com/2.0/"
+
+// lastfmInvalidParams is the Last.fm error code for malformed requests.
+const lastfmInvalidParams = 6
+
+// LastFM submits listens to Last.fm or a compatible API (e.g. Libre.fm).
+// A session key is obtained from Username and Password on first use unless
+// SessionKey is set.
+type LastFM struct {
+	URL        string // API endpoint; DefaultLastFMURL if empty
+	APIKey     string
+	Secret     string
+	SessionKey string
+	Username   string
+	Password   string
+
+	mu sync.Mutex // guards SessionKey
+}
+
+func (lf *LastFM) Name() string {
+	return "lastfm"
+}
+
+func (lf *LastFM) NowPlaying(l Listen) error {
+	params := url.Values{
+		"artist": {l.Artist},
+		"track":  {l.Title},
+	}
+	if l.Album != "" {
+		params.Set("album", l.Album)
+	}
+	if l.Duration > 0 {
+		params.Set("duration", strconv.Itoa(int(l.Duration.Seconds())))
+	}
+	return lf.call("track.updateNowPlaying", params, true, nil)
+}
+
+func (lf *LastFM) Scrobble(ls []Listen) error {
+	params := url.Values{}
+	for i, l := range ls {
+		key := func(name string) string { return fmt.Sprintf("%s[%d]", name, i) }
+		params.Set(key("artist"), l.Artist)
+		params.Set(key("track"), l.Title)
+		params.Set(key("timestamp"), strconv.FormatInt(l.Time.Unix(), 10))
+		if l.Album != "" {
+			params.Set(key("album"), l.Album)
+		}
+		if l.Duration > 0 {
+			params.Set(key("duration"), strconv.Itoa(int(l.Duration.Seconds())))
+		}
+	}
+	return lf.call("track.scrobble", params, true, nil)
+}
+
+// session returns the session key, logging in if necessary.
+func (lf *LastFM) session() (string, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.SessionKey != "" {
+		return lf.SessionKey, nil
+	}
+	if lf.Username == "" || lf.Password == "" {
+		return "", errors.New("lastfm: no session key or username and password configured")
+	}
+
+	var result struct {
+		Session struct {
+			Key string `json:"key"`
+		} `json:"session"`
+	}
+	params := url.Values{"username": {lf.Username}, "password": {lf.Password}}
+	if err := lf.call("auth.getMobileSession", params, false, &result); err != nil {
+		return "", err
+	}
+	lf.SessionKey = result.Session.Key
+	return lf.SessionKey, nil
+}
+
+// call sends a signed API request, decoding the response into out if set.
+func (lf *LastFM) call(method string, params url.Values, auth bool, out any) error {
+	if auth {
+		sk, err := lf.session()
+		if err != nil {
+			return err
+		}
+		params.Set("sk", sk)
+	}
+	params.Set("method", method)
+	params.Set("api_key", lf.APIKey)
+	params.Set("api_sig", lf.sign(params))
+	params.Set("format", "json")
+
+	endpoint := lf.URL
+	if endpoint == "" {
+		endpoint = DefaultLastFMURL
+	}
+	resp, err := httpClient.PostForm(endpoint, params)
+	if err != nil {
+		return fmt.Errorf("lastfm: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("lastfm: %w", err)
+	}
+	var apiErr struct {
+		Code    int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &apiErr) == nil && apiErr.Code != 0 {
+		if apiErr.Code == lastfmInvalidParams {
+			return fmt.Errorf("lastfm: %w: %s", ErrRejected, apiErr.Message)
+		}
+		return fmt.Errorf("lastfm: %s (error %d)", apiErr.Message, apiErr.Code)
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("lastfm: %s", resp.Status)
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// sign computes the api_sig parameter: the MD5 of all parameters sorted by
+// name and concatenated as name+value, followed by the shared secret.
+func (lf *LastFM) sign(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "format" && k != "api_sig" {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteString(params.Get(k))
+	}
+	b.WriteString(lf.Secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,174 @@
+package scrobble
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// fakeLastFM is a stand-in for the Last.fm API. It checks signatures and
+// answers every method with the response set for it.
+type fakeLastFM struct {
+	t         *testing.T
+	responses map[string]string
+	calls     []url.Values
+}
+
+func (f *fakeLastFM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		f.t.Errorf("parsing form: %v", err)
+	}
+	params := r.PostForm
+	f.calls = append(f.calls, params)
+
+	lf := &LastFM{Secret: "shh"}
+	if sig := params.Get("api_sig"); sig != lf.sign(params) {
+		f.t.Errorf("%s: api_sig = %q, want %q", params.Get("method"), sig, lf.sign(params))
+	}
+	if params.Get("api_key") != "key" || params.Get("format") != "json" {
+		f.t.Errorf("%s: params = %v", params.Get("method"), params)
+	}
+	resp, ok := f.responses[params.Get("method")]
+	if !ok {
+		resp = "{}"
+	}
+	fmt.Fprint(w, resp)
+}
+
+func TestLastFM(t *testing.T) {
+	tests := []struct {
+		name       string
+		sessionKey string
+		submit     func(lf *LastFM) error
+		responses  map[string]string
+		wantCalls  []map[string]string
+		wantErr    error
+		wantFail   bool
+	}{
+		{
+			name:       "now playing",
+			sessionKey: "sk1",
+			submit:     func(lf *LastFM) error { return lf.NowPlaying(testListen) },
+			wantCalls: []map[string]string{
+				{"method": "track.updateNowPlaying", "sk": "sk1", "artist": "Artist", "track": "Title", "album": "Album", "duration": "180"},
+			},
+		},
+		{
+			name:       "scrobble",
+			sessionKey: "sk1",
+			submit:     func(lf *LastFM) error { return lf.Scrobble([]Listen{testListen}) },
+			wantCalls: []map[string]string{
+				{"method": "track.scrobble", "sk": "sk1", "artist[0]": "Artist", "track[0]": "Title", "timestamp[0]": "1700000000"},
+			},
+		},
+		{
+			name:      "login first",
+			submit:    func(lf *LastFM) error { return lf.Scrobble([]Listen{testListen}) },
+			responses: map[string]string{"auth.getMobileSession": `{"session": {"key": "sk2"}}`},
+			wantCalls: []map[string]string{
+				{"method": "auth.getMobileSession", "username": "user", "password": "pass"},
+				{"method": "track.scrobble", "sk": "sk2"},
+			},
+		},
+		{
+			name:      "login failed",
+			submit:    func(lf *LastFM) error { return lf.Scrobble([]Listen{testListen}) },
+			responses: map[string]string{"auth.getMobileSession": `{"error": 4, "message": "Authentication Failed"}`},
+			wantCalls: []map[string]string{
+				{"method": "auth.getMobileSession"},
+			},
+			wantFail: true,
+		},
+		{
+			name:       "rejected",
+			sessionKey: "sk1",
+			submit:     func(lf *LastFM) error { return lf.Scrobble([]Listen{testListen}) },
+			responses:  map[string]string{"track.scrobble": `{"error": 6, "message": "Invalid parameters"}`},
+			wantCalls:  []map[string]string{{"method": "track.scrobble"}},
+			wantErr:    ErrRejected,
+		},
+		{
+			name:       "unavailable",
+			sessionKey: "sk1",
+			submit:     func(lf *LastFM) error { return lf.Scrobble([]Listen{testListen}) },
+			responses:  map[string]string{"track.scrobble": `{"error": 16, "message": "Try again later"}`},
+			wantCalls:  []map[string]string{{"method": "track.scrobble"}},
+			wantFail:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeLastFM{t: t, responses: tt.responses}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+
+			lf := &LastFM{URL: srv.URL, APIKey: "key", Secret: "shh", SessionKey: tt.sessionKey, Username: "user", Password: "pass"}
+			err := tt.submit(lf)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantFail:
+				if err == nil || errors.Is(err, ErrRejected) {
+					t.Errorf("err = %v, want a retryable error", err)
+				}
+			case err != nil:
+				t.Errorf("err = %v", err)
+			}
+
+			if len(fake.calls) != len(tt.wantCalls) {
+				t.Fatalf("got %d calls, want %d", len(fake.calls), len(tt.wantCalls))
+			}
+			for i, want := range tt.wantCalls {
+				got := map[string]string{}
+				for k := range want {
+					got[k] = fake.calls[i].Get(k)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("call %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLastFMKeepsSession(t *testing.T) {
+	fake := &fakeLastFM{t: t, responses: map[string]string{"auth.getMobileSession": `{"session": {"key": "sk"}}`}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	lf := &LastFM{URL: srv.URL, APIKey: "key", Secret: "shh", Username: "user", Password: "pass"}
+	for range 2 {
+		if err := lf.NowPlaying(testListen); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var methods []string
+	for _, c := range fake.calls {
+		methods = append(methods, c.Get("method"))
+	}
+	want := []string{"auth.getMobileSession", "track.updateNowPlaying", "track.updateNowPlaying"}
+	if !reflect.DeepEqual(methods, want) {
+		t.Errorf("methods = %q, want %q", methods, want)
+	}
+}
+
+func TestLastFMSign(t *testing.T) {
+	lf := &LastFM{Secret: "mysecret"}
+	params := url.Values{
+		"token":   {"yyyyyy"},
+		"method":  {"auth.getSession"},
+		"api_key": {"xxxxxxxx"},
+		"format":  {"json"}, // not signed
+	}
+	// md5("api_keyxxxxxxxxmethodauth.getSessiontokenyyyyyymysecret")
+	want := "f462da5c166769c6c6014860b36a02af"
+	if got := lf.sign(params); got != want {
+		t.Errorf("sign = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package scrobble
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultListenBrainzURL is the public ListenBrainz API root.
+const DefaultListenBrainzURL = "https://api.listenbrainz.org"
+
+// ListenBrainz submits listens to a ListenBrainz-compatible server.
+type ListenBrainz struct {
+	URL   string // API root; DefaultListenBrainzURL if empty
+	Token string // user token from the ListenBrainz profile page
+}
+
+func (lb *ListenBrainz) Name() string {
+	return "listenbrainz"
+}
+
+type lbPayload struct {
+	ListenedAt int64      `json:"listened_at,omitempty"`
+	Track      lbMetadata `json:"track_metadata"`
+}
+
+type lbMetadata struct {
+	Artist string       `json:"artist_name"`
+	Title  string       `json:"track_name"`
+	Album  string       `json:"release_name,omitempty"`
+	Info   lbAdditional `json:"additional_info"`
+}
+
+type lbAdditional struct {
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Client     string `json:"submission_client"`
+}
+
+func lbListen(l Listen, withTime bool) lbPayload {
+	p := lbPayload{Track: lbMetadata{
+		Artist: l.Artist,
+		Title:  l.Title,
+		Album:  l.Album,
+		Info: lbAdditional{
+			DurationMs: l.Duration.Milliseconds(),
+			Client:     "cliamp",
+		},
+	}}
+	if withTime {
+		p.ListenedAt = l.Time.Unix()
+	}
+	return p
+}
+
+func (lb *ListenBrainz) NowPlaying(l Listen) error {
+	return lb.submit("playing_now", []lbPayload{lbListen(l, false)})
+}
+
+func (lb *ListenBrainz) Scrobble(ls []Listen) error {
+	kind := "single"
+	if len(ls) > 1 {
+		kind = "import"
+	}
+	payload := make([]lbPayload, len(ls))
+	for i, l := range ls {
+		payload[i] = lbListen(l, true)
+	}
+	return lb.submit(kind, payload)
+}
+
+func (lb *ListenBrainz) submit(kind string, payload []lbPayload) error {
+	body, err := json.Marshal(map[string]any{
+		"listen_type": kind,
+		"payload":     payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	root := lb.URL
+	if root == "" {
+		root = DefaultListenBrainzURL
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(root, "/")+"/1/submit-listens", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+lb.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("listenbrainz: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var result struct {
+		Error string `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(data, &result) != nil || result.Error == "" {
+		result.Error = resp.Status
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("listenbrainz: %w: %s", ErrRejected, result.Error)
+	}
+	return fmt.Errorf("listenbrainz: %s", result.Error)
+}
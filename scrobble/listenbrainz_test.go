@@ -0,0 +1,118 @@
+package scrobble
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testListen = Listen{
+	Artist:   "Artist",
+	Title:    "Title",
+	Album:    "Album",
+	Duration: 3 * time.Minute,
+	Time:     time.Unix(1700000000, 0),
+}
+
+func TestListenBrainz(t *testing.T) {
+	second := testListen
+	second.Title = "Second"
+	second.Time = testListen.Time.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		submit   func(lb *ListenBrainz) error
+		status   int
+		response string
+		wantType string
+		wantAt   []int64
+		wantErr  error
+	}{
+		{
+			name:     "now playing",
+			submit:   func(lb *ListenBrainz) error { return lb.NowPlaying(testListen) },
+			status:   http.StatusOK,
+			wantType: "playing_now",
+			wantAt:   []int64{0},
+		},
+		{
+			name:     "single",
+			submit:   func(lb *ListenBrainz) error { return lb.Scrobble([]Listen{testListen}) },
+			status:   http.StatusOK,
+			wantType: "single",
+			wantAt:   []int64{1700000000},
+		},
+		{
+			name:     "import",
+			submit:   func(lb *ListenBrainz) error { return lb.Scrobble([]Listen{testListen, second}) },
+			status:   http.StatusOK,
+			wantType: "import",
+			wantAt:   []int64{1700000000, 1700003600},
+		},
+		{
+			name:     "rejected",
+			submit:   func(lb *ListenBrainz) error { return lb.Scrobble([]Listen{testListen}) },
+			status:   http.StatusBadRequest,
+			response: `{"error": "bad listen"}`,
+			wantType: "single",
+			wantAt:   []int64{1700000000},
+			wantErr:  ErrRejected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Type    string      `json:"listen_type"`
+				Payload []lbPayload `json:"payload"`
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/1/submit-listens" {
+					t.Errorf("request %s %s", r.Method, r.URL.Path)
+				}
+				if auth := r.Header.Get("Authorization"); auth != "Token secret" {
+					t.Errorf("Authorization = %q", auth)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("decoding body: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			err := tt.submit(&ListenBrainz{URL: srv.URL + "/", Token: "secret"})
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got.Type != tt.wantType {
+				t.Errorf("listen_type = %q, want %q", got.Type, tt.wantType)
+			}
+			var at []int64
+			for _, p := range got.Payload {
+				at = append(at, p.ListenedAt)
+				if p.Track.Artist != "Artist" || p.Track.Info.DurationMs != 180000 || p.Track.Info.Client != "cliamp" {
+					t.Errorf("track_metadata = %+v", p.Track)
+				}
+			}
+			if !reflect.DeepEqual(at, tt.wantAt) {
+				t.Errorf("listened_at = %v, want %v", at, tt.wantAt)
+			}
+		})
+	}
+}
+
+func TestListenBrainzServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := (&ListenBrainz{URL: srv.URL}).Scrobble([]Listen{testListen})
+	if err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("err = %v, want a retryable error", err)
+	}
+}
@@ -0,0 +1,222 @@
+// Package scrobble reports listens to services such as ListenBrainz and
+// Last.fm. Scrobbles are kept in an offline queue persisted to
+// $XDG_STATE_HOME/cliamp/scrobbles.json and retried until they are
+// accepted.
+package scrobble
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"cliamp/config"
+)
+
+const (
+	// retryInterval is how often queued scrobbles are retried after a failure.
+	retryInterval = time.Minute
+
+	// batchSize is the most listens submitted in one request (Last.fm's limit).
+	batchSize = 50
+
+	// maxPending caps the offline queue; the oldest listens are dropped first.
+	maxPending = 10000
+)
+
+// httpClient is shared by all services.
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// ErrRejected is wrapped by services when a listen is refused as invalid.
+// Rejected listens are dropped instead of retried.
+var ErrRejected = errors.New("listen rejected")
+
+// Listen is a single play of a track.
+type Listen struct {
+	Artist   string        `json:"artist"`
+	Title    string        `json:"title"`
+	Album    string        `json:"album,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Time     time.Time     `json:"time"` // when playback started
+}
+
+// Service is a scrobbling backend.
+type Service interface {
+	// Name identifies the service in the offline queue.
+	Name() string
+	// NowPlaying announces the track that just started.
+	NowPlaying(l Listen) error
+	// Scrobble submits completed listens.
+	Scrobble(ls []Listen) error
+}
+
+// entry is a listen waiting to be submitted to one service.
+type entry struct {
+	ID      uint64 `json:"id"`
+	Service string `json:"service"`
+	Listen  Listen `json:"listen"`
+}
+
+// Scrobbler fans listens out to services and retries failed submissions
+// in the background.
+type Scrobbler struct {
+	services []Service
+	path     string
+	kick     chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	pending []entry
+	nextID  uint64
+}
+
+// Start loads the offline queue and starts submitting to the services.
+// Queued listens for services that are no longer configured are kept
+// until that service is configured again.
+func Start(services ...Service) (*Scrobbler, error) {
+	path, err := config.File(config.StateDir, "scrobbles.json")
+	if err != nil {
+		return nil, err
+	}
+	s := &Scrobbler{
+		services: services,
+		path:     path,
+		kick:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.pending); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range s.pending {
+		s.nextID = max(s.nextID, e.ID+1)
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	s.flushSoon()
+	return s, nil
+}
+
+// Close stops the background retries. Unsent listens stay on disk.
+func (s *Scrobbler) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+// NowPlaying announces a track to all services without waiting.
+// Failures are not retried since the announcement is only useful now.
+func (s *Scrobbler) NowPlaying(l Listen) {
+	for _, svc := range s.services {
+		go svc.NowPlaying(l)
+	}
+}
+
+// Scrobble queues a completed listen for every service and submits it in
+// the background.
+func (s *Scrobbler) Scrobble(l Listen) {
+	s.mu.Lock()
+	for _, svc := range s.services {
+		s.pending = append(s.pending, entry{ID: s.nextID, Service: svc.Name(), Listen: l})
+		s.nextID++
+	}
+	if n := len(s.pending) - maxPending; n > 0 {
+		s.pending = slices.Delete(s.pending, 0, n)
+	}
+	s.save() // a failed save is retried with the next change
+	s.mu.Unlock()
+
+	s.flushSoon()
+}
+
+func (s *Scrobbler) flushSoon() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scrobbler) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.kick:
+		case <-ticker.C:
+		}
+		s.flush()
+	}
+}
+
+// flush submits queued listens service by service in batches, removing
+// those that were accepted or rejected.
+func (s *Scrobbler) flush() {
+	for _, svc := range s.services {
+		s.mu.Lock()
+		var batch []entry
+		for _, e := range s.pending {
+			if e.Service == svc.Name() {
+				batch = append(batch, e)
+			}
+		}
+		s.mu.Unlock()
+
+		for chunk := range slices.Chunk(batch, batchSize) {
+			listens := make([]Listen, len(chunk))
+			for i, e := range chunk {
+				listens[i] = e.Listen
+			}
+			if err := svc.Scrobble(listens); err != nil && !errors.Is(err, ErrRejected) {
+				break // offline or unavailable; retry later
+			}
+			s.remove(chunk)
+		}
+	}
+}
+
+// remove deletes submitted entries from the queue and saves it.
+func (s *Scrobbler) remove(done []entry) {
+	ids := make(map[uint64]bool, len(done))
+	for _, e := range done {
+		ids[e.ID] = true
+	}
+
+	s.mu.Lock()
+	s.pending = slices.DeleteFunc(s.pending, func(e entry) bool { return ids[e.ID] })
+	s.save()
+	s.mu.Unlock()
+}
+
+// save writes the queue to disk. s.mu must be held.
+func (s *Scrobbler) save() error {
+	if len(s.pending) == 0 {
+		err := os.Remove(s.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.pending, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
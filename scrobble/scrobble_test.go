@@ -0,0 +1,129 @@
+package scrobble
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeService records scrobbles and fails them with err.
+type fakeService struct {
+	name string
+
+	mu    sync.Mutex
+	err   error
+	got   []Listen
+	calls chan struct{}
+}
+
+func newFakeService(name string, err error) *fakeService {
+	return &fakeService{name: name, err: err, calls: make(chan struct{}, 16)}
+}
+
+func (f *fakeService) Name() string            { return f.name }
+func (f *fakeService) NowPlaying(Listen) error { return nil }
+
+func (f *fakeService) Scrobble(ls []Listen) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer func() { f.calls <- struct{}{} }()
+	if f.err != nil {
+		return f.err
+	}
+	f.got = append(f.got, ls...)
+	return nil
+}
+
+func (f *fakeService) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-f.calls:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%s: no scrobble submitted", f.name)
+	}
+}
+
+// queued reads the offline queue from disk.
+func queued(t *testing.T, dir string) []entry {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "cliamp", "scrobbles.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending []entry
+	if err := json.Unmarshal(data, &pending); err != nil {
+		t.Fatal(err)
+	}
+	return pending
+}
+
+func stateDir(t *testing.T) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	return dir
+}
+
+func TestScrobblerQueue(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantQueued int
+	}{
+		{"accepted", nil, 0},
+		{"rejected", ErrRejected, 0},
+		{"offline", errors.New("connection refused"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := stateDir(t)
+			svc := newFakeService("fake", tt.err)
+			s, err := Start(svc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Scrobble(testListen)
+			svc.wait(t)
+			s.Close()
+
+			if n := len(queued(t, dir)); n != tt.wantQueued {
+				t.Errorf("%d listens queued, want %d", n, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestScrobblerRetriesQueued(t *testing.T) {
+	dir := stateDir(t)
+	other := entry{ID: 1, Service: "unconfigured", Listen: testListen}
+	pending := []entry{{ID: 0, Service: "fake", Listen: testListen}, other}
+	data, _ := json.Marshal(pending)
+	os.MkdirAll(filepath.Join(dir, "cliamp"), 0o755)
+	if err := os.WriteFile(filepath.Join(dir, "cliamp", "scrobbles.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := newFakeService("fake", nil)
+	s, err := Start(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.wait(t)
+	s.Close()
+
+	if len(svc.got) != 1 || !svc.got[0].Time.Equal(testListen.Time) {
+		t.Errorf("submitted %v, want the queued listen", svc.got)
+	}
+	// Listens for services that are not configured are kept
+	if got := queued(t, dir); len(got) != 1 || got[0].Service != other.Service {
+		t.Errorf("queue = %+v, want only %+v", got, other)
+	}
+}
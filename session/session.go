@@ -0,0 +1,126 @@
+// Package session saves the playlist and playback position on exit so that
+// the next start can pick up where the last one left off, persisted to
+// $XDG_STATE_HOME/cliamp/session.json.
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cliamp/config"
+	"cliamp/playlist"
+)
+
+// Session is the state restored on the next start.
+type Session struct {
+	Playlist playlist.State
+	Position time.Duration // playback position in the current track
+}
+
+// file is the JSON layout of the session file.
+type file struct {
+	Tracks   []track       `json:"tracks"`
+	Order    []int         `json:"order"`
+	Pos      int           `json:"pos"`
+	Shuffle  bool          `json:"shuffle"`
+	Queue    []int         `json:"queue,omitempty"`
+	Queued   int           `json:"queued"`
+	Position time.Duration `json:"position"`
+}
+
+// track is a saved track. Provider tracks are saved without their stream
+// URLs, which carry credentials and stop working when those change.
+type track struct {
+	Path     string `json:"path,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Artist   string `json:"artist,omitempty"`
+	Album    string `json:"album,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Fallback string `json:"fallback,omitempty"`
+	Starred  bool   `json:"starred,omitempty"`
+	Rating   int    `json:"rating,omitempty"`
+}
+
+// strip drops the stream URLs of a provider track, which its provider
+// rebuilds from the ID when the track is played. Sessions saved by older
+// versions still hold them.
+func (t track) strip() track {
+	if t.Provider != "" && t.ID != "" {
+		t.Path, t.Fallback = "", ""
+	}
+	return t
+}
+
+func path() (string, error) {
+	return config.File(config.StateDir, "session.json")
+}
+
+// Load reads the last session. It returns an empty session if none was
+// saved.
+func Load() (Session, error) {
+	p, err := path()
+	if err != nil {
+		return Session{}, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Session{}, nil
+		}
+		return Session{}, err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Session{}, err
+	}
+
+	s := Session{
+		Playlist: playlist.State{
+			Order:   f.Order,
+			Pos:     f.Pos,
+			Shuffle: f.Shuffle,
+			Queue:   f.Queue,
+			Queued:  f.Queued,
+		},
+		Position: f.Position,
+	}
+	for _, t := range f.Tracks {
+		s.Playlist.Tracks = append(s.Playlist.Tracks, playlist.Track(t.strip()))
+	}
+	return s, nil
+}
+
+// Save writes the session, readable only by the user.
+func Save(s Session) error {
+	p, err := path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+
+	st := s.Playlist
+	f := file{
+		Tracks:   make([]track, 0, len(st.Tracks)),
+		Order:    st.Order,
+		Pos:      st.Pos,
+		Shuffle:  st.Shuffle,
+		Queue:    st.Queue,
+		Queued:   st.Queued,
+		Position: s.Position,
+	}
+	for _, t := range st.Tracks {
+		f.Tracks = append(f.Tracks, track(t).strip())
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o600)
+}
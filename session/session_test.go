@@ -0,0 +1,148 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cliamp/playlist"
+)
+
+// stateDir points the session file at a temporary directory.
+func stateDir(t *testing.T) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	return filepath.Join(dir, "cliamp", "session.json")
+}
+
+func TestLoadWithoutSession(t *testing.T) {
+	stateDir(t)
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, Session{}) {
+		t.Errorf("Load = %+v, want an empty session", s)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	local := playlist.Track{Path: "/music/a.mp3", Title: "A", Artist: "Artist", Album: "Album"}
+	stream := playlist.Track{Path: "https://radio.example/stream", Title: "Radio"}
+	remote := playlist.Track{
+		Path:     "https://nd.example/rest/stream?id=42&u=alice&t=secret",
+		Fallback: "https://nd.example/rest/stream?id=42&format=mp3&u=alice&t=secret",
+		Title:    "Remote",
+		ID:       "42",
+		Provider: "Navidrome",
+		Starred:  true,
+		Rating:   4,
+	}
+	stripped := remote
+	stripped.Path, stripped.Fallback = "", ""
+
+	tests := []struct {
+		name string
+		in   Session
+		want Session
+	}{
+		{
+			name: "local files",
+			in: Session{
+				Playlist: playlist.State{Tracks: []playlist.Track{local, stream}, Order: []int{0, 1}, Pos: 1, Queued: -1},
+				Position: 90 * time.Second,
+			},
+		},
+		{
+			name: "shuffled with queue",
+			in: Session{Playlist: playlist.State{
+				Tracks:  []playlist.Track{local, stream, local},
+				Order:   []int{2, 0, 1},
+				Pos:     2,
+				Shuffle: true,
+				Queue:   []int{1, 0},
+				Queued:  2,
+			}},
+		},
+		{
+			name: "provider tracks lose their URLs",
+			in: Session{Playlist: playlist.State{
+				Tracks: []playlist.Track{local, remote},
+				Order:  []int{0, 1},
+				Queued: -1,
+			}},
+			want: Session{Playlist: playlist.State{
+				Tracks: []playlist.Track{local, stripped},
+				Order:  []int{0, 1},
+				Queued: -1,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := stateDir(t)
+			if err := Save(tt.in); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want.Playlist.Tracks == nil {
+				want = tt.in
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load = %+v\nwant %+v", got, want)
+			}
+
+			fi, err := os.Stat(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := fi.Mode().Perm(); perm != 0o600 {
+				t.Errorf("session file mode = %v, want 0600", perm)
+			}
+			data, _ := os.ReadFile(p)
+			if strings.Contains(string(data), "secret") {
+				t.Errorf("session file holds credentials:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestLoadStripsOldProviderURLs(t *testing.T) {
+	p := stateDir(t)
+	old := `{
+  "tracks": [
+    {"path": "https://nd.example/rest/stream?id=42&t=secret", "fallback": "https://nd.example/x", "title": "Remote", "id": "42", "provider": "Navidrome"},
+    {"path": "/music/a.mp3", "title": "A"}
+  ],
+  "order": [0, 1],
+  "pos": 0,
+  "shuffle": false,
+  "queued": 0,
+  "position": 0
+}`
+	os.MkdirAll(filepath.Dir(p), 0o700)
+	if err := os.WriteFile(p, []byte(old), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []playlist.Track{
+		{Title: "Remote", ID: "42", Provider: "Navidrome"},
+		{Path: "/music/a.mp3", Title: "A"},
+	}
+	if !reflect.DeepEqual(s.Playlist.Tracks, want) {
+		t.Errorf("tracks = %+v, want %+v", s.Playlist.Tracks, want)
+	}
+}
@@ -0,0 +1,260 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"cliamp/ipc"
+	"cliamp/player"
+	"cliamp/playlist"
+)
+
+// attachPollInterval is how often an attached TUI refreshes the status.
+const attachPollInterval = 250 * time.Millisecond
+
+// AttachModel is a TUI that drives a running instance (typically a headless
+// daemon) over the control socket instead of owning a player.
+type AttachModel struct {
+	sock     string
+	status   ipc.Status
+	tracks   []ipc.TrackInfo
+	synced   bool // tracks reflect the current status
+	cursor   int  // selected playlist item
+	scroll   int  // scroll offset for playlist view
+	visible  int  // max visible playlist items
+	titleOff int
+	err      error
+	quitting bool
+	width    int
+	height   int
+}
+
+// NewAttachModel creates an AttachModel that talks to the control socket
+// at sock.
+func NewAttachModel(sock string) AttachModel {
+	return AttachModel{sock: sock, status: ipc.Status{Index: -1}, visible: 5}
+}
+
+type attachTickMsg time.Time
+
+// attachReplyMsg carries the response to a control request.
+type attachReplyMsg struct {
+	resp ipc.Response
+	list bool // the request was "list"
+	err  error
+}
+
+func attachTickCmd() tea.Cmd {
+	return tea.Tick(attachPollInterval, func(t time.Time) tea.Msg {
+		return attachTickMsg(t)
+	})
+}
+
+// send issues a control request in the background.
+func (m AttachModel) send(cmd string, args ...string) tea.Cmd {
+	sock := m.sock
+	return func() tea.Msg {
+		resp, err := ipc.Send(sock, ipc.Request{Cmd: cmd, Args: args})
+		return attachReplyMsg{resp: resp, list: cmd == "list", err: err}
+	}
+}
+
+// Init fetches the playlist and starts polling.
+func (m AttachModel) Init() tea.Cmd {
+	return tea.Batch(m.send("list"), attachTickCmd(), tea.WindowSize())
+}
+
+// Update handles key presses, poll ticks and control replies.
+func (m AttachModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		cmd := m.handleKey(msg)
+		if m.quitting {
+			return m, tea.Quit
+		}
+		return m, cmd
+
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+
+	case attachTickMsg:
+		m.titleOff++
+		return m, tea.Batch(m.send("status"), attachTickCmd())
+
+	case attachReplyMsg:
+		m.err = msg.err
+		if msg.resp.Status == nil {
+			return m, nil
+		}
+		prev := m.status
+		m.status = *msg.resp.Status
+		if msg.list {
+			m.tracks = msg.resp.Playlist
+			m.synced = true
+			m.cursor = min(m.cursor, max(0, len(m.tracks)-1))
+			m.adjustScroll()
+			return m, nil
+		}
+		if m.status.Track.Path != prev.Track.Path {
+			m.titleOff = 0
+		}
+		// Refetch the playlist when tracks or the queue changed
+		if m.synced && (m.status.Tracks != prev.Tracks || m.status.Queue != prev.Queue) {
+			m.synced = false
+			return m, m.send("list")
+		}
+	}
+	return m, nil
+}
+
+func (m *AttachModel) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		// Detach; the daemon keeps playing
+		m.quitting = true
+		return nil
+	case " ":
+		return m.send("toggle")
+	case "s":
+		return m.send("stop")
+	case ">", ".":
+		return m.send("next")
+	case "<", ",":
+		return m.send("prev")
+	case "left":
+		return m.send("seek", "-5")
+	case "right":
+		return m.send("seek", "+5")
+	case "+", "=":
+		return m.send("volume", "+1")
+	case "-":
+		return m.send("volume", "-1")
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+			m.adjustScroll()
+		}
+	case "down", "j":
+		if m.cursor < len(m.tracks)-1 {
+			m.cursor++
+			m.adjustScroll()
+		}
+	case "enter":
+		if len(m.tracks) > 0 {
+			return m.send("play", strconv.Itoa(m.cursor+1))
+		}
+	case "a":
+		if len(m.tracks) > 0 {
+			if m.tracks[m.cursor].Queued > 0 {
+				return m.send("dequeue", strconv.Itoa(m.cursor+1))
+			}
+			return m.send("queue", strconv.Itoa(m.cursor+1))
+		}
+	case "r":
+		next := map[string]string{"off": "all", "all": "one", "one": "off"}[m.status.Repeat]
+		return m.send("repeat", next)
+	case "z":
+		return m.send("shuffle", "toggle")
+	case "e":
+		next := 0
+		for i, p := range player.EQPresets {
+			if p.Name == m.status.EQPreset {
+				next = (i + 1) % len(player.EQPresets)
+			}
+		}
+		return m.send("eq", "preset", player.EQPresets[next].Name)
+	case "t":
+		return m.send("sleep", nextSleep(m.status.Sleep))
+	case "T":
+		return m.send("sleep", "off")
+	}
+	return nil
+}
+
+// nextSleep returns the sleep timer setting that follows the reported one
+// in the order the TUI's sleep key cycles through. A running timer only
+// reports the time left, which selects the next longer preset.
+func nextSleep(cur string) string {
+	switch cur {
+	case "":
+		return strconv.Itoa(int(sleepPresets[0].Minutes()))
+	case "end of track":
+		return "album"
+	case "end of album":
+		return "off"
+	}
+	var mins, secs int
+	fmt.Sscanf(cur, "%d:%d", &mins, &secs)
+	left := time.Duration(mins)*time.Minute + time.Duration(secs)*time.Second
+	for _, d := range sleepPresets {
+		if d > left {
+			return strconv.Itoa(int(d.Minutes()))
+		}
+	}
+	return "track"
+}
+
+// adjustScroll ensures the cursor is visible in the playlist view.
+func (m *AttachModel) adjustScroll() {
+	if m.cursor < m.scroll {
+		m.scroll = m.cursor
+	}
+	if m.cursor >= m.scroll+m.visible {
+		m.scroll = m.cursor - m.visible + 1
+	}
+}
+
+// View renders the attached TUI frame with the same parts as the TUI.
+func (m AttachModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	st := m.status
+	sections := []string{
+		titleStyle.Render("C L I A M P") + dimStyle.Render("  [attached]"),
+		trackInfo(st, m.titleOff),
+		timeStatus(st),
+		"",
+		seekBar(seconds(st.Position), seconds(st.Duration)),
+		"",
+		volumeBar(st.Volume),
+		eqLine(st, -1),
+		"",
+		playlistHeader(st),
+		m.renderPlaylist(),
+		"",
+		helpStyle.Render("[Spc]⏯  [<>]Trk [←→]Seek [+-]Vol [e]EQ [a]Queue [r]Rpt [z]Shfl [t]Sleep [q]Detach"),
+	}
+
+	switch {
+	case m.err != nil:
+		sections = append(sections, errorStyle.Render(fmt.Sprintf("ERR: %s", m.err)))
+	case st.Err != "":
+		sections = append(sections, errorStyle.Render("ERR: "+st.Err))
+	}
+	return center(frameStyle.Render(strings.Join(sections, "\n")), m.width, m.height)
+}
+
+func (m AttachModel) renderPlaylist() string {
+	if len(m.tracks) == 0 {
+		return dimStyle.Render("  No tracks loaded")
+	}
+
+	visible := min(m.visible, len(m.tracks))
+	scroll := max(0, min(m.scroll, len(m.tracks)-visible))
+
+	lines := make([]string, 0, visible)
+	for i := scroll; i < scroll+visible && i < len(m.tracks); i++ {
+		t := m.tracks[i]
+		playing := i == m.status.Index && m.status.State != "stopped"
+		badges := trackBadges(playlist.Track{Starred: t.Starred, Rating: t.Rating})
+		lines = append(lines, playlistLine(i, trackName(t), badges, t.Queued, playing, i == m.cursor))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,252 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"cliamp/playlist"
+)
+
+// browseLevel is one level of the provider library browser.
+type browseLevel struct {
+	title   string
+	prov    playlist.Provider // nil for the source selector
+	entries []playlist.Entry
+	cursor  int
+	single  bool // playing a track adds only that track, e.g. search results
+}
+
+// browseMsg carries the entries of a library level that finished loading.
+type browseMsg struct {
+	title   string
+	prov    playlist.Provider
+	entries []playlist.Entry
+	single  bool
+}
+
+func browseCmd(prov playlist.Provider, id, title string) tea.Cmd {
+	return func() tea.Msg {
+		entries, err := browseProvider(prov, id)
+		if err != nil {
+			return err
+		}
+		return browseMsg{title: title, prov: prov, entries: tagEntries(prov, entries)}
+	}
+}
+
+// searchCmd runs a library search and shows the results as a new level.
+func searchCmd(prov playlist.Provider, query string) tea.Cmd {
+	return func() tea.Msg {
+		entries, err := prov.(playlist.Searcher).Search(query)
+		if err != nil {
+			return err
+		}
+		return browseMsg{title: fmt.Sprintf("Search %q", query), prov: prov, entries: tagEntries(prov, entries), single: true}
+	}
+}
+
+// tagEntries records on each track which provider it came from.
+func tagEntries(prov playlist.Provider, entries []playlist.Entry) []playlist.Entry {
+	for _, e := range entries {
+		if e.Track != nil {
+			e.Track.Provider = prov.Name()
+		}
+	}
+	return entries
+}
+
+// sourcesLevel lists the configured providers to choose from.
+func (m *Model) sourcesLevel() browseLevel {
+	entries := make([]playlist.Entry, len(m.providers))
+	for i, p := range m.providers {
+		entries[i] = playlist.Entry{ID: p.Name(), Name: p.Name()}
+	}
+	return browseLevel{title: "Sources", entries: entries}
+}
+
+// browsingProvider returns the provider of the level currently shown, or
+// nil at the source selector.
+func (m *Model) browsingProvider() playlist.Provider {
+	if lvl := m.browseTop(); lvl != nil {
+		return lvl.prov
+	}
+	if len(m.providers) == 1 {
+		return m.providers[0]
+	}
+	return nil
+}
+
+// providerFor returns the provider a track came from, or nil for local
+// files.
+func (m *Model) providerFor(t playlist.Track) playlist.Provider {
+	if t.Provider == "" {
+		return nil
+	}
+	for _, p := range m.providers {
+		if p.Name() == t.Provider {
+			return p
+		}
+	}
+	return nil
+}
+
+// streamURLs returns the URLs to play a track from. Provider tracks
+// restored from a session are saved without them and get fresh ones from
+// their provider.
+func (m *Model) streamURLs(t playlist.Track) (path, fallback string, err error) {
+	if t.Path != "" || t.ID == "" {
+		return t.Path, t.Fallback, nil
+	}
+	s, ok := m.providerFor(t).(playlist.Streamer)
+	if !ok {
+		return "", "", fmt.Errorf("%s: provider %q is not configured", t.DisplayName(), t.Provider)
+	}
+	return s.StreamURLs(t.ID)
+}
+
+// browseProvider lists the children of a library entry. Providers without
+// a hierarchical library expose their playlists at the root.
+func browseProvider(prov playlist.Provider, id string) ([]playlist.Entry, error) {
+	if b, ok := prov.(playlist.Browser); ok {
+		return b.Browse(id)
+	}
+
+	if id == "" {
+		lists, err := prov.Playlists()
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]playlist.Entry, len(lists))
+		for i, p := range lists {
+			entries[i] = playlist.Entry{ID: p.ID, Name: p.Name, Info: fmt.Sprintf("%d tracks", p.TrackCount)}
+		}
+		return entries, nil
+	}
+
+	tracks, err := prov.Tracks(id)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]playlist.Entry, len(tracks))
+	for i := range tracks {
+		entries[i] = playlist.Entry{ID: tracks[i].ID, Name: tracks[i].DisplayName(), Track: &tracks[i]}
+	}
+	return entries, nil
+}
+
+// browseTop returns the level currently shown, or nil while the root loads.
+func (m *Model) browseTop() *browseLevel {
+	if len(m.browse) == 0 {
+		return nil
+	}
+	return &m.browse[len(m.browse)-1]
+}
+
+// openEntry descends into the selected container, or plays the selected
+// track along with the rest of its level.
+func (m *Model) openEntry() tea.Cmd {
+	lvl := m.browseTop()
+	if lvl == nil || len(lvl.entries) == 0 || m.provLoading {
+		return nil
+	}
+	e := lvl.entries[lvl.cursor]
+	if e.Track != nil {
+		if lvl.single {
+			m.playEntries(lvl.entries[lvl.cursor:lvl.cursor+1], 0)
+		} else {
+			m.playEntries(lvl.entries, lvl.cursor)
+		}
+		return nil
+	}
+	m.provLoading = true
+	if lvl.prov == nil {
+		return browseCmd(m.providers[lvl.cursor], "", e.Name)
+	}
+	return browseCmd(lvl.prov, e.ID, e.Name)
+}
+
+// startLibrarySearch begins typing a search query if the provider
+// supports searching its library.
+func (m *Model) startLibrarySearch() {
+	if _, ok := m.browsingProvider().(playlist.Searcher); ok && !m.provLoading {
+		m.provSearch = true
+		m.searchQuery = ""
+	}
+}
+
+// handleLibrarySearchKey processes key presses while typing a library
+// search query.
+func (m *Model) handleLibrarySearchKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEscape:
+		m.provSearch = false
+
+	case tea.KeyEnter:
+		m.provSearch = false
+		query := strings.TrimSpace(m.searchQuery)
+		prov := m.browsingProvider()
+		if _, ok := prov.(playlist.Searcher); ok && query != "" {
+			m.provLoading = true
+			return searchCmd(prov, query)
+		}
+
+	case tea.KeyBackspace:
+		if len(m.searchQuery) > 0 {
+			_, size := utf8.DecodeLastRuneInString(m.searchQuery)
+			m.searchQuery = m.searchQuery[:len(m.searchQuery)-size]
+		}
+
+	case tea.KeyRunes, tea.KeySpace:
+		m.searchQuery += string(msg.Runes)
+	}
+	return nil
+}
+
+// browseBack returns to the parent level.
+func (m *Model) browseBack() {
+	if len(m.browse) > 1 && !m.provLoading {
+		m.browse = m.browse[:len(m.browse)-1]
+	}
+}
+
+// playEntries appends the tracks among entries to the playlist and starts
+// playing the one at index at.
+func (m *Model) playEntries(entries []playlist.Entry, at int) {
+	start := m.playlist.Len()
+	target := start
+	var tracks []playlist.Track
+	for i, e := range entries {
+		if e.Track == nil {
+			continue
+		}
+		if i == at {
+			target = start + len(tracks)
+		}
+		tracks = append(tracks, *e.Track)
+	}
+	if len(tracks) == 0 {
+		return
+	}
+	m.playlist.Add(tracks...)
+	m.playlist.SetIndex(target)
+	m.plCursor = target
+	m.adjustScroll()
+	m.focus = focusPlaylist
+	m.playCurrentTrack()
+}
+
+// queueEntry appends the selected track to the playlist and queues it to
+// play next.
+func (m *Model) queueEntry() {
+	lvl := m.browseTop()
+	if lvl == nil || len(lvl.entries) == 0 {
+		return
+	}
+	if t := lvl.entries[lvl.cursor].Track; t != nil {
+		m.playlist.Add(*t)
+		m.playlist.Queue(m.playlist.Len() - 1)
+	}
+}
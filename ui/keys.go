@@ -5,6 +5,8 @@ import (
 	"unicode/utf8"
 
 	tea "github.com/charmbracelet/bubbletea"
+
+	"cliamp/player"
 )
 
 // handleKey processes a single key press and returns an optional command.
@@ -12,38 +14,18 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 	if m.searching {
 		return m.handleSearchKey(msg)
 	}
+	if m.naming {
+		return m.handleNameKey(msg)
+	}
+	if m.provSearch {
+		return m.handleLibrarySearchKey(msg)
+	}
+	if m.focus == focusBookmarks {
+		return m.handleBookmarkKey(msg)
+	}
 
 	if m.focus == focusProvider {
-		switch msg.String() {
-		case "q", "ctrl+c":
-			m.player.Close()
-			m.quitting = true
-			return tea.Quit
-		case "up", "k":
-			if m.provCursor > 0 {
-				m.provCursor--
-			}
-		case " ":
-			if !m.player.IsPlaying() {
-				m.playCurrentTrack()
-			} else {
-				m.player.TogglePause()
-			}
-		case "down", "j":
-			if m.provCursor < len(m.providerLists)-1 {
-				m.provCursor++
-			}
-		case "enter":
-			if len(m.providerLists) > 0 && !m.provLoading {
-				m.provLoading = true
-				return fetchTracksCmd(m.provider, m.providerLists[m.provCursor].ID)
-			}
-		case "tab":
-			if m.playlist.Len() > 0 {
-				m.focus = focusPlaylist
-			}
-		}
-		return nil
+		return m.handleProviderKey(msg)
 	}
 
 	switch msg.String() {
@@ -52,7 +34,7 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 		m.quitting = true
 		return tea.Quit
 	case "esc", "backspace", "b":
-		if m.focus == focusPlaylist && m.provider != nil {
+		if m.focus == focusPlaylist && len(m.providers) > 0 {
 			m.focus = focusProvider
 		}
 
@@ -151,7 +133,7 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 
 	case "e":
 		m.eqPresetIdx++
-		if m.eqPresetIdx >= len(eqPresets) {
+		if m.eqPresetIdx >= len(player.EQPresets) {
 			m.eqPresetIdx = 0
 		}
 		m.applyEQPreset()
@@ -163,6 +145,41 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 			}
 		}
 
+	case "f":
+		return m.toggleStar()
+
+	case "0", "1", "2", "3", "4", "5":
+		return m.rateTrack(int(msg.Runes[0] - '0'))
+
+	case "t":
+		m.cycleSleep()
+
+	case "T":
+		m.cancelSleep()
+
+	case "[":
+		m.player.SetLoopA()
+
+	case "]":
+		m.player.SetLoopB()
+
+	case "\\":
+		m.player.ClearLoop()
+
+	case "m":
+		if m.player.IsPlaying() && m.bookmarks != nil {
+			m.naming = true
+			m.nameInput = ""
+			m.namePos = m.player.Position()
+		}
+
+	case "'":
+		if m.bookmarks != nil {
+			m.bmCursor = 0
+			m.prevFocus = m.focus
+			m.focus = focusBookmarks
+		}
+
 	case "/":
 		m.searching = true
 		m.searchQuery = ""
@@ -175,6 +192,48 @@ func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
 	return nil
 }
 
+// handleProviderKey processes key presses in the provider library browser.
+func (m *Model) handleProviderKey(msg tea.KeyMsg) tea.Cmd {
+	lvl := m.browseTop()
+	switch msg.String() {
+	case "q", "ctrl+c":
+		m.player.Close()
+		m.quitting = true
+		return tea.Quit
+	case "up", "k":
+		if lvl != nil && lvl.cursor > 0 {
+			lvl.cursor--
+		}
+	case "down", "j":
+		if lvl != nil && lvl.cursor < len(lvl.entries)-1 {
+			lvl.cursor++
+		}
+	case " ":
+		if !m.player.IsPlaying() {
+			m.playCurrentTrack()
+		} else {
+			m.player.TogglePause()
+		}
+	case "enter", "right", "l":
+		return m.openEntry()
+	case "esc", "backspace", "left", "h", "b":
+		m.browseBack()
+	case "a":
+		m.queueEntry()
+	case "f":
+		return m.toggleStar()
+	case "0", "1", "2", "3", "4", "5":
+		return m.rateTrack(int(msg.Runes[0] - '0'))
+	case "/":
+		m.startLibrarySearch()
+	case "tab":
+		if m.playlist.Len() > 0 {
+			m.focus = focusPlaylist
+		}
+	}
+	return nil
+}
+
 // handleSearchKey processes key presses while in search mode.
 func (m *Model) handleSearchKey(msg tea.KeyMsg) tea.Cmd {
 	switch msg.Type {
@@ -219,3 +278,82 @@ func (m *Model) handleSearchKey(msg tea.KeyMsg) tea.Cmd {
 
 	return nil
 }
+
+// handleNameKey processes key presses while typing a bookmark name.
+func (m *Model) handleNameKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEscape:
+		m.naming = false
+
+	case tea.KeyEnter:
+		m.addBookmark()
+		m.naming = false
+
+	case tea.KeyBackspace:
+		if len(m.nameInput) > 0 {
+			_, size := utf8.DecodeLastRuneInString(m.nameInput)
+			m.nameInput = m.nameInput[:len(m.nameInput)-size]
+		}
+
+	case tea.KeySpace:
+		m.nameInput += " "
+
+	default:
+		if msg.Type == tea.KeyRunes {
+			m.nameInput += string(msg.Runes)
+		}
+	}
+
+	return nil
+}
+
+// handleBookmarkKey processes key presses while the bookmark list is focused.
+func (m *Model) handleBookmarkKey(msg tea.KeyMsg) tea.Cmd {
+	marks := m.currentBookmarks()
+
+	switch msg.String() {
+	case "q", "ctrl+c":
+		m.player.Close()
+		m.quitting = true
+		return tea.Quit
+
+	case "esc", "'":
+		m.focus = m.prevFocus
+
+	case "up", "k":
+		if m.bmCursor > 0 {
+			m.bmCursor--
+		}
+
+	case "down", "j":
+		if m.bmCursor < len(marks)-1 {
+			m.bmCursor++
+		}
+
+	case "enter":
+		if m.bmCursor < len(marks) {
+			if !m.player.IsPlaying() {
+				m.playCurrentTrack()
+			}
+			if err := m.player.SeekTo(marks[m.bmCursor].Position); err != nil {
+				m.err = err
+			}
+		}
+
+	case "d":
+		if m.bmCursor < len(marks) {
+			track, _ := m.playlist.Current()
+			if err := m.bookmarks.Remove(track, m.bmCursor); err != nil {
+				m.err = err
+			}
+			if m.bmCursor >= len(marks)-1 && m.bmCursor > 0 {
+				m.bmCursor--
+			}
+		}
+
+	case " ":
+		m.player.TogglePause()
+	}
+
+	return nil
+}
@@ -7,8 +7,10 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"cliamp/bookmark"
 	"cliamp/player"
 	"cliamp/playlist"
+	"cliamp/scrobble"
 )
 
 type focusArea int
@@ -18,6 +20,7 @@ const (
 	focusEQ
 	focusSearch
 	focusProvider
+	focusBookmarks
 )
 
 type tickMsg time.Time
@@ -38,11 +41,11 @@ type Model struct {
 	width     int
 	height    int
 
-	provider      playlist.Provider
-	providerLists []playlist.PlaylistInfo
-	provCursor    int
-	provLoading   bool
-	// EQ preset state (-1 = custom, 0+ = index into eqPresets)
+	providers   []playlist.Provider
+	browse      []browseLevel // provider library navigation stack
+	provLoading bool
+	provSearch  bool // typing a library search query into searchQuery
+	// EQ preset state (-1 = custom, 0+ = index into player.EQPresets)
 	eqPresetIdx int
 
 	// Search mode state
@@ -51,10 +54,33 @@ type Model struct {
 	searchResults []int // indices into playlist tracks
 	searchCursor  int
 	prevFocus     focusArea // focus to restore on cancel
+
+	// Bookmarks for the current track
+	bookmarks *bookmark.Store
+	bmCursor  int
+	naming    bool          // typing a name for a new bookmark
+	nameInput string        // bookmark name being typed
+	namePos   time.Duration // position captured when naming started
+
+	// Sleep timer state
+	sleep    sleepMode
+	sleepLen time.Duration // length of the armed timed preset
+	sleepAt  time.Time     // when a timed sleep fires
+
+	// Scrobbling state
+	scrobbler *scrobble.Scrobbler
+	listen    listenState
+
+	// Restored session: position to seek to when its current track is
+	// first played, 0 if none
+	resumeKey string
+	resumeAt  time.Duration
 }
 
-// NewModel creates a Model wired to the given player and playlist.
-func NewModel(p *player.Player, pl *playlist.Playlist, prov playlist.Provider) Model {
+// NewModel creates a Model wired to the given player, playlist and
+// providers. With more than one provider, the library browser starts at a
+// source selector listing them.
+func NewModel(p *player.Player, pl *playlist.Playlist, providers []playlist.Provider) Model {
 	m := Model{
 		player:      p,
 		playlist:    pl,
@@ -62,17 +88,31 @@ func NewModel(p *player.Player, pl *playlist.Playlist, prov playlist.Provider) M
 		plVisible:   5,
 		eqPresetIdx: -1, // custom until a preset is selected
 	}
-	if prov != nil {
-		m.provider = prov
+	m.providers = providers
+	switch {
+	case len(providers) == 1:
 		m.focus = focusProvider
 		m.provLoading = true
+	case len(providers) > 1:
+		m.focus = focusProvider
+		m.browse = []browseLevel{m.sourcesLevel()}
 	}
 	return m
 }
 
+// SetBookmarks attaches the bookmark store used for per-track bookmarks.
+func (m *Model) SetBookmarks(s *bookmark.Store) {
+	m.bookmarks = s
+}
+
+// SetScrobbler attaches the scrobbler that listens are reported to.
+func (m *Model) SetScrobbler(s *scrobble.Scrobbler) {
+	m.scrobbler = s
+}
+
 // SetEQPreset sets the preset index by name. Returns true if found.
 func (m *Model) SetEQPreset(name string) bool {
-	for i, p := range eqPresets {
+	for i, p := range player.EQPresets {
 		if strings.EqualFold(p.Name, name) {
 			m.eqPresetIdx = i
 			m.applyEQPreset()
@@ -82,52 +122,57 @@ func (m *Model) SetEQPreset(name string) bool {
 	return false
 }
 
+// Resume positions the playlist view on the restored current track and
+// makes its first playback start at pos.
+func (m *Model) Resume(pos time.Duration) {
+	track, idx := m.playlist.Current()
+	if idx < 0 {
+		return
+	}
+	m.focus = focusPlaylist
+	m.plCursor = idx
+	m.adjustScroll()
+	if pos > 0 {
+		m.resumeKey = track.Key()
+		m.resumeAt = pos
+	}
+}
+
+// Position returns the playback position to save with the session: the
+// player's while a track is loaded, else the restored position that has
+// not been played from yet.
+func (m Model) Position() time.Duration {
+	if m.player.IsPlaying() {
+		return m.player.Position()
+	}
+	return m.resumeAt
+}
+
 // EQPresetName returns the current preset name, or "Custom".
 func (m Model) EQPresetName() string {
-	if m.eqPresetIdx < 0 || m.eqPresetIdx >= len(eqPresets) {
+	if m.eqPresetIdx < 0 || m.eqPresetIdx >= len(player.EQPresets) {
 		return "Custom"
 	}
-	return eqPresets[m.eqPresetIdx].Name
+	return player.EQPresets[m.eqPresetIdx].Name
 }
 
 // applyEQPreset writes the current preset's bands to the player.
 func (m *Model) applyEQPreset() {
-	if m.eqPresetIdx < 0 || m.eqPresetIdx >= len(eqPresets) {
+	if m.eqPresetIdx < 0 || m.eqPresetIdx >= len(player.EQPresets) {
 		return
 	}
-	bands := eqPresets[m.eqPresetIdx].Bands
+	bands := player.EQPresets[m.eqPresetIdx].Bands
 	for i, gain := range bands {
 		m.player.SetEQBand(i, gain)
 	}
 }
 
-func fetchPlaylistsCmd(prov playlist.Provider) tea.Cmd {
-	return func() tea.Msg {
-		pls, err := prov.Playlists()
-		if err != nil {
-			return err
-		}
-		return pls
-	}
-}
-
-type tracksLoadedMsg []playlist.Track
-
-func fetchTracksCmd(prov playlist.Provider, playlistID string) tea.Cmd {
-	return func() tea.Msg {
-		tracks, err := prov.Tracks(playlistID)
-		if err != nil {
-			return err
-		}
-		return tracksLoadedMsg(tracks)
-	}
-}
-
 // Init starts the tick timer and requests the terminal size.
 func (m Model) Init() tea.Cmd {
 	cmds := []tea.Cmd{tickCmd(), tea.WindowSize()}
-	if m.provider != nil {
-		cmds = append(cmds, fetchPlaylistsCmd(m.provider))
+	if len(m.providers) == 1 {
+		prov := m.providers[0]
+		cmds = append(cmds, browseCmd(prov, "", prov.Name()))
 	}
 	return tea.Batch(cmds...)
 }
@@ -155,23 +200,32 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tickMsg:
 		// Check if the current track finished naturally
 		if m.player.IsPlaying() && !m.player.IsPaused() && m.player.TrackDone() {
-			m.nextTrack()
+			if m.sleepEndsAfterTrack() {
+				m.stopForSleep()
+			} else {
+				m.nextTrack()
+			}
 		}
+		m.updateSleep()
+		m.updateListen()
 		m.titleOff++
 		return m, tickCmd()
 
-	case []playlist.PlaylistInfo:
-		m.providerLists = msg
-		m.provLoading = false
+	case remoteMsg:
+		msg.reply <- m.execRemote(msg.req)
+		if m.quitting {
+			return m, tea.Quit
+		}
 		return m, nil
 
-	case tracksLoadedMsg:
-		m.playlist.Add(msg...)
-		m.focus = focusPlaylist
+	case browseMsg:
+		m.browse = append(m.browse, browseLevel{title: msg.title, prov: msg.prov, entries: msg.entries, single: msg.single})
 		m.provLoading = false
-		if m.playlist.Len() > 0 {
-			m.playCurrentTrack()
-		}
+		return m, nil
+
+	case rateFailedMsg:
+		m.updateTrack(msg.prev)
+		m.err = msg.err
 		return m, nil
 
 	case error:
@@ -192,9 +246,7 @@ func (m *Model) nextTrack() {
 	}
 	m.plCursor = m.playlist.Index()
 	m.adjustScroll()
-	if err := m.player.Play(track.Path); err != nil {
-		m.err = err
-	}
+	m.play(track)
 }
 
 // prevTrack goes to the previous track, or restarts if >3s into the current one.
@@ -209,9 +261,7 @@ func (m *Model) prevTrack() {
 	}
 	m.plCursor = m.playlist.Index()
 	m.adjustScroll()
-	if err := m.player.Play(track.Path); err != nil {
-		m.err = err
-	}
+	m.play(track)
 }
 
 // playCurrentTrack starts playing whatever track the playlist cursor points to.
@@ -221,9 +271,29 @@ func (m *Model) playCurrentTrack() {
 		return
 	}
 	m.titleOff = 0
-	if err := m.player.Play(track.Path); err != nil {
+	m.play(track)
+}
+
+// play starts playing a track and begins tracking the listen.
+func (m *Model) play(track playlist.Track) {
+	path, fallback, err := m.streamURLs(track)
+	if err == nil {
+		err = m.player.Play(path)
+	}
+	if err != nil && fallback != "" {
+		err = m.player.Play(fallback)
+	}
+	if err != nil {
 		m.err = err
+		return
 	}
+	if m.resumeAt > 0 && track.Key() == m.resumeKey {
+		if err := m.player.SeekTo(m.resumeAt); err != nil {
+			m.err = err
+		}
+	}
+	m.resumeKey, m.resumeAt = "", 0
+	m.startListen(track)
 }
 
 // adjustScroll ensures plCursor is visible in the playlist view.
@@ -236,6 +306,30 @@ func (m *Model) adjustScroll() {
 	}
 }
 
+// addBookmark saves the bookmark being named at the captured position.
+func (m *Model) addBookmark() {
+	track, idx := m.playlist.Current()
+	if idx < 0 || m.bookmarks == nil {
+		return
+	}
+	name := strings.TrimSpace(m.nameInput)
+	if name == "" {
+		name = formatDuration(m.namePos)
+	}
+	if err := m.bookmarks.Add(track, bookmark.Bookmark{Name: name, Position: m.namePos}); err != nil {
+		m.err = err
+	}
+}
+
+// currentBookmarks returns the bookmarks of the current track.
+func (m Model) currentBookmarks() []bookmark.Bookmark {
+	track, idx := m.playlist.Current()
+	if idx < 0 || m.bookmarks == nil {
+		return nil
+	}
+	return m.bookmarks.List(track)
+}
+
 // updateSearch filters the playlist by the current search query.
 func (m *Model) updateSearch() {
 	m.searchResults = nil
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"cliamp/playlist"
+)
+
+// selectedTrack returns the track under the cursor in the playlist or the
+// provider browser.
+func (m *Model) selectedTrack() (playlist.Track, bool) {
+	switch m.focus {
+	case focusProvider:
+		if lvl := m.browseTop(); lvl != nil && len(lvl.entries) > 0 {
+			if t := lvl.entries[lvl.cursor].Track; t != nil {
+				return *t, true
+			}
+		}
+	case focusPlaylist:
+		if m.plCursor >= 0 && m.plCursor < m.playlist.Len() {
+			return m.playlist.Tracks()[m.plCursor], true
+		}
+	}
+	return playlist.Track{}, false
+}
+
+// rateFailedMsg reports a failed star or rating change along with the
+// track as it was before, so the optimistic update can be undone.
+type rateFailedMsg struct {
+	prev playlist.Track
+	err  error
+}
+
+// toggleStar stars or unstars the selected track on the provider.
+func (m *Model) toggleStar() tea.Cmd {
+	t, found := m.selectedTrack()
+	rater, ok := m.providerFor(t).(playlist.Rater)
+	if !ok || !found || t.ID == "" {
+		return nil
+	}
+	prev := t
+	t.Starred = !t.Starred
+	m.updateTrack(t)
+	return func() tea.Msg {
+		if err := rater.SetStarred(t.ID, t.Starred); err != nil {
+			return rateFailedMsg{prev, err}
+		}
+		return nil
+	}
+}
+
+// rateTrack sets the selected track's rating on the provider (0 clears it).
+func (m *Model) rateTrack(rating int) tea.Cmd {
+	t, found := m.selectedTrack()
+	rater, ok := m.providerFor(t).(playlist.Rater)
+	if !ok || !found || t.ID == "" {
+		return nil
+	}
+	prev := t
+	t.Rating = rating
+	m.updateTrack(t)
+	return func() tea.Msg {
+		if err := rater.SetRating(t.ID, rating); err != nil {
+			return rateFailedMsg{prev, err}
+		}
+		return nil
+	}
+}
+
+// updateTrack applies changed metadata to every copy of a provider track
+// in the playlist and the library browser.
+func (m *Model) updateTrack(t playlist.Track) {
+	for i, pt := range m.playlist.Tracks() {
+		if pt.ID == t.ID && pt.Provider == t.Provider {
+			pt.Starred, pt.Rating = t.Starred, t.Rating
+			m.playlist.SetTrack(i, pt)
+		}
+	}
+	for _, lvl := range m.browse {
+		for _, e := range lvl.entries {
+			if e.Track != nil && e.Track.ID == t.ID && e.Track.Provider == t.Provider {
+				e.Track.Starred, e.Track.Rating = t.Starred, t.Rating
+			}
+		}
+	}
+}
+
+// trackBadges renders a track's favorite and rating markers.
+func trackBadges(t playlist.Track) string {
+	var b strings.Builder
+	if t.Starred {
+		b.WriteString(" ♥")
+	}
+	if t.Rating > 0 {
+		b.WriteString(" " + strings.Repeat("★", t.Rating))
+	}
+	return b.String()
+}
@@ -0,0 +1,336 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"cliamp/ipc"
+	"cliamp/player"
+	"cliamp/playlist"
+)
+
+// remoteMsg carries a control request into the Bubbletea update loop so that
+// it is applied on the same goroutine as key presses.
+type remoteMsg struct {
+	req   ipc.Request
+	reply chan ipc.Response
+}
+
+// RemoteHandler returns an ipc.Handler that forwards requests to the running
+// program and waits for the model to apply them.
+func RemoteHandler(prog *tea.Program) ipc.Handler {
+	return func(req ipc.Request) ipc.Response {
+		reply := make(chan ipc.Response, 1)
+		go prog.Send(remoteMsg{req: req, reply: reply})
+		select {
+		case resp := <-reply:
+			return resp
+		case <-time.After(5 * time.Second):
+			return ipc.Response{Error: "timed out waiting for player"}
+		}
+	}
+}
+
+// execRemote applies a control request and returns the resulting status.
+func (m *Model) execRemote(req ipc.Request) ipc.Response {
+	if err := m.applyRemote(req); err != nil {
+		return ipc.Response{Error: redactURLs(err.Error())}
+	}
+	status := m.remoteStatus()
+	resp := ipc.Response{OK: true, Status: &status}
+	if req.Cmd == "list" {
+		resp.Playlist = m.remotePlaylist()
+	}
+	return resp
+}
+
+func (m *Model) applyRemote(req ipc.Request) error {
+	arg := ""
+	if len(req.Args) > 0 {
+		arg = req.Args[0]
+	}
+
+	switch req.Cmd {
+	case "status":
+
+	case "play":
+		if arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > m.playlist.Len() {
+				return fmt.Errorf("invalid track number %q", arg)
+			}
+			m.playlist.SetIndex(n - 1)
+			m.plCursor = n - 1
+			m.adjustScroll()
+			m.playCurrentTrack()
+		} else if !m.player.IsPlaying() {
+			m.playCurrentTrack()
+		} else if m.player.IsPaused() {
+			m.player.TogglePause()
+		}
+
+	case "pause":
+		if m.player.IsPlaying() && !m.player.IsPaused() {
+			m.player.TogglePause()
+		}
+
+	case "toggle":
+		if !m.player.IsPlaying() {
+			m.playCurrentTrack()
+		} else {
+			m.player.TogglePause()
+		}
+
+	case "stop":
+		m.player.Stop()
+
+	case "next":
+		m.nextTrack()
+
+	case "prev":
+		m.prevTrack()
+
+	case "seek":
+		d, relative, err := parseRelative(arg)
+		if err != nil {
+			return fmt.Errorf("invalid seek %q: %w", arg, err)
+		}
+		if relative {
+			return m.player.Seek(time.Duration(d * float64(time.Second)))
+		}
+		return m.player.SeekTo(time.Duration(d * float64(time.Second)))
+
+	case "volume":
+		v, relative, err := parseRelative(arg)
+		if err != nil {
+			return fmt.Errorf("invalid volume %q: %w", arg, err)
+		}
+		if relative {
+			v += m.player.Volume()
+		}
+		m.player.SetVolume(v)
+
+	case "queue":
+		if len(req.Args) == 0 {
+			return errors.New("queue needs a track number or path")
+		}
+		for _, a := range req.Args {
+			if n, err := strconv.Atoi(a); err == nil {
+				if n < 1 || n > m.playlist.Len() {
+					return fmt.Errorf("invalid track number %q", a)
+				}
+				m.playlist.Queue(n - 1)
+				continue
+			}
+			m.playlist.Add(playlist.TrackFromPath(a))
+			m.playlist.Queue(m.playlist.Len() - 1)
+		}
+
+	case "repeat":
+		mode, err := parseRepeat(arg)
+		if err != nil {
+			return err
+		}
+		for m.playlist.Repeat() != mode {
+			m.playlist.CycleRepeat()
+		}
+
+	case "shuffle":
+		switch arg {
+		case "on", "true":
+			if !m.playlist.Shuffled() {
+				m.playlist.ToggleShuffle()
+			}
+		case "off", "false":
+			if m.playlist.Shuffled() {
+				m.playlist.ToggleShuffle()
+			}
+		case "", "toggle":
+			m.playlist.ToggleShuffle()
+		default:
+			return fmt.Errorf("invalid shuffle %q: want on, off or toggle", arg)
+		}
+
+	case "add":
+		if len(req.Args) == 0 {
+			return errors.New("add needs a path")
+		}
+		for _, a := range req.Args {
+			m.playlist.Add(playlist.TrackFromPath(a))
+		}
+
+	case "dequeue":
+		for _, a := range req.Args {
+			n, err := strconv.Atoi(a)
+			if err != nil || !m.playlist.Dequeue(n-1) {
+				return fmt.Errorf("track %q is not queued", a)
+			}
+		}
+
+	case "eq":
+		return m.applyRemoteEQ(req.Args)
+
+	case "sleep":
+		return m.SetSleep(arg)
+
+	case "list":
+
+	case "quit":
+		m.player.Close()
+		m.quitting = true
+
+	default:
+		return fmt.Errorf("unknown command %q", req.Cmd)
+	}
+	return nil
+}
+
+// applyRemoteEQ handles "eq preset NAME", "eq BAND DB" (1-based band)
+// and "eq DB DB ..." with all ten band gains.
+func (m *Model) applyRemoteEQ(args []string) error {
+	switch {
+	case len(args) >= 2 && args[0] == "preset":
+		name := strings.Join(args[1:], " ")
+		if !m.SetEQPreset(name) {
+			return fmt.Errorf("unknown EQ preset %q", name)
+		}
+		return nil
+
+	case len(args) == 2:
+		band, err := strconv.Atoi(args[0])
+		if err != nil || band < 1 || band > len(player.EQFreqs) {
+			return fmt.Errorf("invalid EQ band %q", args[0])
+		}
+		gain, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid EQ gain %q", args[1])
+		}
+		m.player.SetEQBand(band-1, gain)
+
+	case len(args) == len(player.EQFreqs):
+		var gains [10]float64
+		for i, a := range args {
+			g, err := strconv.ParseFloat(a, 64)
+			if err != nil {
+				return fmt.Errorf("invalid EQ gain %q", a)
+			}
+			gains[i] = g
+		}
+		for i, g := range gains {
+			m.player.SetEQBand(i, g)
+		}
+
+	default:
+		return errors.New("eq needs \"preset NAME\", \"BAND DB\" or ten gains")
+	}
+	m.eqPresetIdx = -1 // manual bands → custom
+	return nil
+}
+
+// parseRepeat parses a repeat mode name as reported in Status.Repeat.
+func parseRepeat(s string) (playlist.RepeatMode, error) {
+	for _, mode := range []playlist.RepeatMode{playlist.RepeatOff, playlist.RepeatAll, playlist.RepeatOne} {
+		if strings.EqualFold(s, mode.String()) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid repeat mode %q: want off, all or one", s)
+}
+
+// parseRelative parses "+N" / "-N" as a relative value and "N" or "=N" as
+// absolute; the "=" form allows negative absolute values.
+func parseRelative(s string) (v float64, relative bool, err error) {
+	if s == "" {
+		return 0, false, errors.New("missing value")
+	}
+	if abs, ok := strings.CutPrefix(s, "="); ok {
+		v, err = strconv.ParseFloat(abs, 64)
+		return v, false, err
+	}
+	relative = s[0] == '+' || s[0] == '-'
+	v, err = strconv.ParseFloat(strings.TrimPrefix(s, "+"), 64)
+	return v, relative, err
+}
+
+// remoteStatus snapshots the player and playlist for control clients.
+func (m Model) remoteStatus() ipc.Status {
+	track, idx := m.playlist.Current()
+	state := "stopped"
+	switch {
+	case m.player.IsPlaying() && m.player.IsPaused():
+		state = "paused"
+	case m.player.IsPlaying():
+		state = "playing"
+	}
+	bands := m.player.EQBands()
+	status := ipc.Status{
+		State: state,
+		Track: ipc.TrackInfo{
+			Path:   track.Key(),
+			Title:  track.Title,
+			Artist: track.Artist,
+			Album:  track.Album,
+		},
+		Index:    idx,
+		Position: m.player.Position().Seconds(),
+		Duration: m.player.Duration().Seconds(),
+		Volume:   m.player.Volume(),
+		Repeat:   strings.ToLower(m.playlist.Repeat().String()),
+		Shuffle:  m.playlist.Shuffled(),
+		Tracks:   m.playlist.Len(),
+		Queue:    m.playlist.QueueLen(),
+		Sleep:    m.sleepStatus(),
+		EQ:       bands[:],
+		EQPreset: m.EQPresetName(),
+	}
+	if a, b, hasA, active := m.player.Loop(); hasA || active {
+		status.Loop = &ipc.Loop{A: a.Seconds(), B: b.Seconds(), Active: active}
+	}
+	if m.err != nil {
+		status.Err = redactURLs(m.err.Error())
+	}
+	return status
+}
+
+// remotePlaylist lists the playlist tracks for control clients.
+func (m Model) remotePlaylist() []ipc.TrackInfo {
+	tracks := m.playlist.Tracks()
+	out := make([]ipc.TrackInfo, len(tracks))
+	for i, t := range tracks {
+		out[i] = ipc.TrackInfo{
+			Path:    t.Key(),
+			Title:   t.Title,
+			Artist:  t.Artist,
+			Album:   t.Album,
+			Queued:  m.playlist.QueuePosition(i),
+			Starred: t.Starred,
+			Rating:  t.Rating,
+		}
+	}
+	return out
+}
+
+// urlPattern matches URLs in error messages, leaving out punctuation that
+// follows them such as the colon in "GET URL: reason".
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]*[^\s"'<>.,:;)]`)
+
+// redactURLs drops the user info and query of URLs in an error message
+// before it is shown to control clients, since provider stream URLs carry
+// credentials there.
+func redactURLs(s string) string {
+	return urlPattern.ReplaceAllStringFunc(s, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "<url>"
+		}
+		u.User, u.RawQuery, u.Fragment = nil, "", ""
+		return u.String()
+	})
+}
@@ -0,0 +1,55 @@
+package ui
+
+import "testing"
+
+func TestRedactURLs(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"no url here", "no url here"},
+		{
+			`open https://nd.example/rest/stream?id=1&u=alice&t=abc&s=salt: 404`,
+			`open https://nd.example/rest/stream: 404`,
+		},
+		{
+			`Get "http://alice:pw@jf.example:8096/Audio/1/universal?api_key=k#x": EOF`,
+			`Get "http://jf.example:8096/Audio/1/universal": EOF`,
+		},
+		{
+			"two: http://a.example/?t=1 and http://b.example/x?t=2",
+			"two: http://a.example/ and http://b.example/x",
+		},
+		{"/music/a.mp3: no such file", "/music/a.mp3: no such file"},
+	}
+	for _, tt := range tests {
+		if got := redactURLs(tt.in); got != tt.want {
+			t.Errorf("redactURLs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRelative(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     float64
+		relative bool
+		wantErr  bool
+	}{
+		{in: "10", want: 10},
+		{in: "+5", want: 5, relative: true},
+		{in: "-2.5", want: -2.5, relative: true},
+		{in: "=-6", want: -6},
+		{in: "", wantErr: true},
+		{in: "loud", wantErr: true},
+	}
+	for _, tt := range tests {
+		v, relative, err := parseRelative(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRelative(%q) err = %v", tt.in, err)
+			continue
+		}
+		if !tt.wantErr && (v != tt.want || relative != tt.relative) {
+			t.Errorf("parseRelative(%q) = %v, %v, want %v, %v", tt.in, v, relative, tt.want, tt.relative)
+		}
+	}
+}
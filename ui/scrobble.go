@@ -0,0 +1,142 @@
+package ui
+
+import (
+	"time"
+
+	"cliamp/playlist"
+	"cliamp/scrobble"
+)
+
+const (
+	// scrobbleMinLength is the shortest track that is scrobbled.
+	scrobbleMinLength = 30 * time.Second
+
+	// scrobbleMaxWait caps the listening time needed to scrobble long tracks.
+	scrobbleMaxWait = 4 * time.Minute
+
+	// playbackReportInterval is how often the provider is told the
+	// position of the current track.
+	playbackReportInterval = 10 * time.Second
+)
+
+// listenState tracks how long the current track has actually been heard,
+// so that seeking ahead does not count towards the scrobble threshold.
+type listenState struct {
+	track     playlist.Track
+	started   time.Time
+	played    time.Duration
+	lastTick  time.Time
+	active    bool
+	submitted bool
+
+	position time.Duration // last known position, for the final report
+	paused   bool          // pause state last reported to the provider
+	reported time.Time     // time of the last playback report
+}
+
+// startListen begins tracking a new play of track and announces it.
+func (m *Model) startListen(track playlist.Track) {
+	m.endListen()
+	now := time.Now()
+	m.listen = listenState{track: track, started: now, lastTick: now, active: true}
+	if m.scrobbler != nil && track.Artist != "" {
+		m.scrobbler.NowPlaying(m.listenFor(track))
+	}
+	m.reportPlay(false)
+	m.reportPlayback("playing")
+}
+
+// endListen tells the provider that the current track stopped playing.
+func (m *Model) endListen() {
+	if m.listen.active {
+		m.listen.active = false
+		m.reportPlayback("stopped")
+	}
+}
+
+// updateListen accumulates playing time and scrobbles the track once it
+// has played for half its length or four minutes, whichever comes first.
+// The provider is told about every play; scrobbling services only about
+// tracks of at least 30 seconds. The provider also hears about pauses and,
+// every ten seconds, the position.
+func (m *Model) updateListen() {
+	l := &m.listen
+	if !l.active {
+		return
+	}
+	if !m.player.IsPlaying() {
+		m.endListen()
+		return
+	}
+	now := time.Now()
+	paused := m.player.IsPaused()
+	if !paused {
+		l.played += now.Sub(l.lastTick)
+	}
+	l.lastTick = now
+	l.position = m.player.Position()
+
+	if paused != l.paused || now.Sub(l.reported) >= playbackReportInterval {
+		l.paused = paused
+		if paused {
+			m.reportPlayback("paused")
+		} else {
+			m.reportPlayback("playing")
+		}
+	}
+	if l.submitted {
+		return
+	}
+
+	threshold := scrobbleMaxWait
+	d := m.player.Duration()
+	if d > 0 {
+		threshold = min(d/2, scrobbleMaxWait)
+	}
+	if l.played < threshold {
+		return
+	}
+
+	l.submitted = true
+	m.reportPlay(true)
+	if m.scrobbler != nil && l.track.Artist != "" && (d == 0 || d >= scrobbleMinLength) {
+		listen := m.listenFor(l.track)
+		listen.Time = l.started
+		m.scrobbler.Scrobble(listen)
+	}
+}
+
+// reportPlay tells the provider of the current track that it started
+// playing, or with submission set, that it was played.
+func (m *Model) reportPlay(submission bool) {
+	sc, ok := m.providerFor(m.listen.track).(playlist.Scrobbler)
+	if !ok || m.listen.track.ID == "" {
+		return
+	}
+	id, at := m.listen.track.ID, m.listen.started
+	go sc.Scrobble(id, at, submission)
+}
+
+// reportPlayback tells the provider of the current track its state and
+// last known position.
+func (m *Model) reportPlayback(state string) {
+	l := &m.listen
+	l.reported = time.Now()
+	pr, ok := m.providerFor(l.track).(playlist.PlaybackReporter)
+	if !ok || l.track.ID == "" {
+		return
+	}
+	id, pos := l.track.ID, l.position
+	go pr.ReportPlayback(id, state, pos)
+}
+
+// listenFor builds the scrobble metadata for a track.
+func (m *Model) listenFor(track playlist.Track) scrobble.Listen {
+	return scrobble.Listen{
+		Artist:   track.Artist,
+		Title:    track.Title,
+		Album:    track.Album,
+		Duration: m.player.Duration(),
+		Time:     time.Now(),
+	}
+}
@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sleepMode selects when the sleep timer stops playback.
+type sleepMode int
+
+const (
+	sleepOff sleepMode = iota
+	sleepTimed
+	sleepEndOfTrack
+	sleepEndOfAlbum
+)
+
+// sleepFade is how long the volume fades out before the sleep timer fires.
+const sleepFade = 10 * time.Second
+
+// sleepPresets are the timer lengths cycled through by the sleep key.
+var sleepPresets = []time.Duration{15 * time.Minute, 30 * time.Minute, 45 * time.Minute, 60 * time.Minute, 90 * time.Minute}
+
+// cycleSleep steps through off → timed presets → end of track → end of album → off.
+func (m *Model) cycleSleep() {
+	switch m.sleep {
+	case sleepOff:
+		m.startSleepTimer(sleepPresets[0])
+	case sleepTimed:
+		for _, d := range sleepPresets {
+			if d > m.sleepLen {
+				m.startSleepTimer(d)
+				return
+			}
+		}
+		m.sleep = sleepEndOfTrack
+	case sleepEndOfTrack:
+		m.sleep = sleepEndOfAlbum
+	default:
+		m.cancelSleep()
+	}
+}
+
+// SetSleep configures the sleep timer from a spec: a number of minutes
+// (optionally a Go duration such as "1h30m"), "track", "album" or "off".
+func (m *Model) SetSleep(spec string) error {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	switch spec {
+	case "off", "cancel", "":
+		m.cancelSleep()
+		return nil
+	case "track":
+		m.sleep = sleepEndOfTrack
+		return nil
+	case "album":
+		m.sleep = sleepEndOfAlbum
+		return nil
+	}
+	if mins, err := strconv.Atoi(spec); err == nil && mins > 0 {
+		m.startSleepTimer(time.Duration(mins) * time.Minute)
+		return nil
+	}
+	if d, err := time.ParseDuration(spec); err == nil && d > 0 {
+		m.startSleepTimer(d)
+		return nil
+	}
+	return fmt.Errorf("invalid sleep timer %q: want minutes, a duration, \"track\", \"album\" or \"off\"", spec)
+}
+
+func (m *Model) startSleepTimer(d time.Duration) {
+	m.sleep = sleepTimed
+	m.sleepLen = d
+	m.sleepAt = time.Now().Add(d)
+}
+
+// cancelSleep turns the timer off and restores full volume.
+func (m *Model) cancelSleep() {
+	m.sleep = sleepOff
+	m.player.SetFade(1)
+}
+
+// sleepEndsAfterTrack reports whether the timer should stop playback when
+// the current track finishes instead of advancing.
+func (m Model) sleepEndsAfterTrack() bool {
+	switch m.sleep {
+	case sleepEndOfTrack:
+		return true
+	case sleepEndOfAlbum:
+		cur, _ := m.playlist.Current()
+		next, ok := m.playlist.PeekNext()
+		return !ok || !cur.SameAlbum(next)
+	}
+	return false
+}
+
+// sleepRemaining returns the time left until the timer fires, or ok=false
+// when the remaining time is not yet bounded (e.g. more album tracks follow).
+func (m Model) sleepRemaining() (time.Duration, bool) {
+	switch m.sleep {
+	case sleepTimed:
+		return max(0, time.Until(m.sleepAt)), true
+	case sleepEndOfTrack, sleepEndOfAlbum:
+		if !m.sleepEndsAfterTrack() || !m.player.IsPlaying() {
+			return 0, false
+		}
+		return max(0, m.player.Duration()-m.player.Position()), true
+	}
+	return 0, false
+}
+
+// updateSleep fades the volume over the final seconds of the timer and
+// stops playback when it expires.
+func (m *Model) updateSleep() {
+	if m.sleep == sleepOff {
+		return
+	}
+	// An A-B loop keeps the track from ever ending; the timer wins
+	if m.sleep != sleepTimed {
+		if _, _, _, active := m.player.Loop(); active {
+			m.player.ClearLoop()
+		}
+	}
+	remaining, ok := m.sleepRemaining()
+	if !ok {
+		m.player.SetFade(1)
+		return
+	}
+	if m.sleep == sleepTimed && remaining == 0 {
+		m.stopForSleep()
+		return
+	}
+	m.player.SetFade(float64(remaining) / float64(sleepFade))
+}
+
+// stopForSleep stops playback and disarms the timer.
+func (m *Model) stopForSleep() {
+	m.player.Stop()
+	m.cancelSleep()
+}
+
+// sleepStatus describes an armed sleep timer, or returns "" when it is off.
+func (m Model) sleepStatus() string {
+	switch m.sleep {
+	case sleepTimed:
+		return formatDuration(max(0, time.Until(m.sleepAt)))
+	case sleepEndOfTrack:
+		return "end of track"
+	case sleepEndOfAlbum:
+		return "end of album"
+	}
+	return ""
+}
@@ -3,9 +3,11 @@ package ui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 
+	"cliamp/ipc"
 	"cliamp/playlist"
 )
 
@@ -25,22 +27,23 @@ func (m Model) View() string {
 		return ""
 	}
 
+	st := m.remoteStatus()
 	sections := []string{
 		// Now playing
-		m.renderTitle(),
-		m.renderTrackInfo(),
-		m.renderTimeStatus(),
+		titleStyle.Render("C L I A M P"),
+		trackInfo(st, m.titleOff),
+		timeStatus(st),
 		"",
 		// Visualizer
 		m.renderSpectrum(),
-		m.renderSeekBar(),
+		seekBar(seconds(st.Position), seconds(st.Duration)),
 		"",
 		// Controls
-		m.renderVolume(),
-		m.renderEQ(),
+		volumeBar(st.Volume),
+		m.renderEQ(st),
 		"",
 		// Playlist
-		m.renderPlaylistHeader(),
+		m.renderPlaylistHeader(st),
 		m.renderPlaylist(),
 		"",
 		// Help
@@ -50,30 +53,32 @@ func (m Model) View() string {
 	if m.err != nil {
 		sections = append(sections, errorStyle.Render(fmt.Sprintf("ERR: %s", m.err)))
 	}
+	return center(frameStyle.Render(strings.Join(sections, "\n")), m.width, m.height)
+}
 
-	content := strings.Join(sections, "\n")
-	frame := frameStyle.Render(content)
-
-	// Center horizontally and vertically within the terminal
-	frameW := lipgloss.Width(frame)
-	frameH := lipgloss.Height(frame)
-
-	padLeft := max(0, (m.width-frameW)/2)
-	padTop := max(0, (m.height-frameH)/2)
+// center places the frame in the middle of a width×height terminal.
+func center(frame string, width, height int) string {
+	padLeft := max(0, (width-lipgloss.Width(frame))/2)
+	padTop := max(0, (height-lipgloss.Height(frame))/2)
 
 	return strings.Repeat("\n", padTop) +
 		lipgloss.NewStyle().MarginLeft(padLeft).Render(frame)
 }
 
-func (m Model) renderTitle() string {
-	return titleStyle.Render("C L I A M P")
+// The functions below render the parts of the frame shared with the
+// attached TUI from a status snapshot, so both show the same.
+
+// seconds converts a position from a status to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
 }
 
-func (m Model) renderTrackInfo() string {
-	track, _ := m.playlist.Current()
-	name := track.DisplayName()
-	if name == "" {
-		name = "No track loaded"
+// trackInfo renders the current track's name, scrolled by titleOff when
+// it is too long.
+func trackInfo(st ipc.Status, titleOff int) string {
+	name := "No track loaded"
+	if st.Index >= 0 {
+		name = trackName(st.Track)
 	}
 
 	maxW := panelWidth - 4
@@ -87,7 +92,7 @@ func (m Model) renderTrackInfo() string {
 	sep := []rune("   ♫   ")
 	padded := append(runes, sep...)
 	total := len(padded)
-	off := m.titleOff % total
+	off := titleOff % total
 
 	display := make([]rune, maxW)
 	for i := range maxW {
@@ -96,28 +101,35 @@ func (m Model) renderTrackInfo() string {
 	return trackStyle.Render("♫ " + string(display))
 }
 
-func (m Model) renderTimeStatus() string {
-	pos := m.player.Position()
-	dur := m.player.Duration()
-
-	posMin := int(pos.Minutes())
-	posSec := int(pos.Seconds()) % 60
-	durMin := int(dur.Minutes())
-	durSec := int(dur.Seconds()) % 60
+// trackName formats a status track like Track.DisplayName.
+func trackName(t ipc.TrackInfo) string {
+	return playlist.Track{Title: t.Title, Artist: t.Artist}.DisplayName()
+}
 
-	timeStr := fmt.Sprintf("%02d:%02d / %02d:%02d", posMin, posSec, durMin, durSec)
+// timeStatus renders the position and A-B loop on the left and the sleep
+// timer and playback state on the right.
+func timeStatus(st ipc.Status) string {
+	timeStr := formatDuration(seconds(st.Position)) + " / " + formatDuration(seconds(st.Duration))
 
 	var status string
-	switch {
-	case m.player.IsPlaying() && m.player.IsPaused():
+	switch st.State {
+	case "paused":
 		status = statusStyle.Render("⏸ Paused")
-	case m.player.IsPlaying():
+	case "playing":
 		status = statusStyle.Render("▶ Playing")
 	default:
 		status = dimStyle.Render("■ Stopped")
 	}
+	if st.Sleep != "" {
+		status = activeToggle.Render("☾ "+st.Sleep) + "  " + status
+	}
 
 	left := timeStyle.Render(timeStr)
+	if l := st.Loop; l != nil && l.Active {
+		left += " " + activeToggle.Render(fmt.Sprintf("[A-B %s–%s]", formatDuration(seconds(l.A)), formatDuration(seconds(l.B))))
+	} else if l != nil {
+		left += " " + activeToggle.Render(fmt.Sprintf("[A %s]", formatDuration(seconds(l.A))))
+	}
 	gap := panelWidth - lipgloss.Width(left) - lipgloss.Width(status)
 	if gap < 1 {
 		gap = 1
@@ -126,15 +138,18 @@ func (m Model) renderTimeStatus() string {
 	return left + strings.Repeat(" ", gap) + status
 }
 
+// formatDuration formats d as mm:ss.
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
 func (m Model) renderSpectrum() string {
 	bands := m.vis.Analyze(m.player.Samples())
 	return m.vis.Render(bands)
 }
 
-func (m Model) renderSeekBar() string {
-	pos := m.player.Position()
-	dur := m.player.Duration()
-
+// seekBar renders a progress bar for pos within dur.
+func seekBar(pos, dur time.Duration) string {
 	var progress float64
 	if dur > 0 {
 		progress = float64(pos) / float64(dur)
@@ -148,8 +163,8 @@ func (m Model) renderSeekBar() string {
 		seekDimStyle.Render(strings.Repeat("━", max(0, panelWidth-filled-1)))
 }
 
-func (m Model) renderVolume() string {
-	vol := m.player.Volume()
+// volumeBar renders the volume gauge for vol in dB.
+func volumeBar(vol float64) string {
 	frac := max(0, min(1, (vol+30)/36))
 
 	barW := 30
@@ -161,8 +176,19 @@ func (m Model) renderVolume() string {
 	return labelStyle.Render("VOL ") + bar + dimStyle.Render(fmt.Sprintf(" %+.1fdB", vol))
 }
 
-func (m Model) renderEQ() string {
-	bands := m.player.EQBands()
+func (m Model) renderEQ(st ipc.Status) string {
+	cursor := -1
+	if m.focus == focusEQ {
+		cursor = m.eqCursor
+	}
+	return eqLine(st, cursor)
+}
+
+// eqLine renders the EQ band gains, highlighting the band at cursor
+// (-1 for none).
+func eqLine(st ipc.Status, cursor int) string {
+	var bands [10]float64
+	copy(bands[:], st.EQ)
 	labels := [10]string{"70", "180", "320", "600", "1k", "3k", "6k", "12k", "14k", "16k"}
 
 	parts := make([]string, len(labels))
@@ -171,67 +197,91 @@ func (m Model) renderEQ() string {
 		if bands[i] != 0 {
 			label = fmt.Sprintf("%+.0f", bands[i])
 		}
-		if m.focus == focusEQ && i == m.eqCursor {
+		if i == cursor {
 			style = eqActiveStyle
 		}
 		parts[i] = style.Render(label)
 	}
 
-	presetName := m.EQPresetName()
-	presetLabel := dimStyle.Render(" [" + presetName + "]")
+	presetLabel := dimStyle.Render(" [" + st.EQPreset + "]")
 	return labelStyle.Render("EQ  ") + strings.Join(parts, " ") + presetLabel
 }
 
-func (m Model) renderPlaylistHeader() string {
+func (m Model) renderPlaylistHeader(st ipc.Status) string {
+	if m.focus == focusBookmarks {
+		return dimStyle.Render("── Bookmarks ── ")
+	}
 	if m.focus == focusProvider {
-		return dimStyle.Render(fmt.Sprintf("── %s Playlists ── ", m.provider.Name()))
+		return dimStyle.Render("── " + m.browsePath() + " ── ")
 	}
+	return playlistHeader(st)
+}
 
+// playlistHeader renders the playlist title with the shuffle, repeat and
+// queue state.
+func playlistHeader(st ipc.Status) string {
 	var shuffle string
-	if m.playlist.Shuffled() {
+	if st.Shuffle {
 		shuffle = activeToggle.Render("[Shuffle]")
 	} else {
 		shuffle = dimStyle.Render("[Shuffle]")
 	}
 
-	repeatStr := fmt.Sprintf("[Repeat: %s]", m.playlist.Repeat())
-	if m.playlist.Repeat() != 0 {
+	repeat, _ := parseRepeat(st.Repeat)
+	repeatStr := fmt.Sprintf("[Repeat: %s]", repeat)
+	if repeat != playlist.RepeatOff {
 		repeatStr = activeToggle.Render(repeatStr)
 	} else {
 		repeatStr = dimStyle.Render(repeatStr)
 	}
 
 	var queueStr string
-	if qLen := m.playlist.QueueLen(); qLen > 0 {
-		queueStr = " " + activeToggle.Render(fmt.Sprintf("[Queue: %d]", qLen))
+	if st.Queue > 0 {
+		queueStr = " " + activeToggle.Render(fmt.Sprintf("[Queue: %d]", st.Queue))
 	}
 
 	return dimStyle.Render("── Playlist ── ") + shuffle + " " + repeatStr + queueStr + " " + dimStyle.Render("──")
 }
 
+// playlistLine renders playlist item i (0-based): its name with badges,
+// marked when it is the track being played or the selected one, and its
+// queue position if it is queued.
+func playlistLine(i int, name, badges string, queued int, playing, selected bool) string {
+	prefix := "  "
+	style := playlistItemStyle
+
+	if playing {
+		prefix = "▶ "
+		style = playlistActiveStyle
+	}
+	if selected {
+		style = playlistSelectedStyle
+	}
+
+	queueSuffix := ""
+	if queued > 0 {
+		queueSuffix = fmt.Sprintf(" [Q%d]", queued)
+	}
+	maxW := panelWidth - 6 - len([]rune(queueSuffix)) - len([]rune(badges))
+	nameRunes := []rune(name)
+	if len(nameRunes) > maxW {
+		name = string(nameRunes[:maxW-1]) + "…"
+	}
+
+	line := style.Render(fmt.Sprintf("%s%d. %s%s", prefix, i+1, name, badges))
+	if queueSuffix != "" {
+		line += activeToggle.Render(queueSuffix)
+	}
+	return line
+}
+
 func (m Model) renderPlaylist() string {
 	if m.focus == focusProvider {
-		if m.provLoading {
-			return dimStyle.Render(fmt.Sprintf("  Loading %s...", m.provider.Name()))
-		}
-		if len(m.providerLists) == 0 {
-			return dimStyle.Render("  No playlists found.")
-		}
+		return m.renderBrowser()
+	}
 
-		visible := min(m.plVisible, len(m.providerLists))
-		scroll := max(0, m.provCursor-visible+1)
-
-		var lines []string
-		for j := scroll; j < scroll+visible && j < len(m.providerLists); j++ {
-			p := m.providerLists[j]
-			prefix, style := "  ", playlistItemStyle
-			if j == m.provCursor {
-				style = playlistSelectedStyle
-				prefix = "> "
-			}
-			lines = append(lines, style.Render(fmt.Sprintf("%s%s (%d tracks)", prefix, p.Name, p.TrackCount)))
-		}
-		return strings.Join(lines, "\n")
+	if m.focus == focusBookmarks {
+		return m.renderBookmarks()
 	}
 
 	tracks := m.playlist.Tracks()
@@ -254,36 +304,9 @@ func (m Model) renderPlaylist() string {
 
 	lines := make([]string, 0, visible)
 	for i := scroll; i < scroll+visible && i < len(tracks); i++ {
-		prefix := "  "
-		style := playlistItemStyle
-
-		if i == currentIdx && m.player.IsPlaying() {
-			prefix = "▶ "
-			style = playlistActiveStyle
-		}
-
-		if m.focus == focusPlaylist && i == m.plCursor {
-			style = playlistSelectedStyle
-		}
-
-		name := tracks[i].DisplayName()
-		queueSuffix := ""
-		if qp := m.playlist.QueuePosition(i); qp > 0 {
-			queueSuffix = fmt.Sprintf(" [Q%d]", qp)
-		}
-		maxW := panelWidth - 6 - len([]rune(queueSuffix))
-		nameRunes := []rune(name)
-		if len(nameRunes) > maxW {
-			name = string(nameRunes[:maxW-1]) + "…"
-		}
-
-		line := fmt.Sprintf("%s%d. %s", prefix, i+1, name)
-		if queueSuffix != "" {
-			line = style.Render(line) + activeToggle.Render(queueSuffix)
-		} else {
-			line = style.Render(line)
-		}
-		lines = append(lines, line)
+		playing := i == currentIdx && m.player.IsPlaying()
+		selected := m.focus == focusPlaylist && i == m.plCursor
+		lines = append(lines, playlistLine(i, tracks[i].DisplayName(), trackBadges(tracks[i]), m.playlist.QueuePosition(i), playing, selected))
 	}
 
 	return strings.Join(lines, "\n")
@@ -334,20 +357,117 @@ func (m Model) renderSearchResults(tracks []playlist.Track) string {
 	return strings.Join(lines, "\n")
 }
 
+// browsePath renders the breadcrumb of the library levels, dropping the
+// leading levels when it gets too long.
+func (m Model) browsePath() string {
+	titles := make([]string, len(m.browse))
+	for i, lvl := range m.browse {
+		titles[i] = lvl.title
+	}
+	if len(titles) == 0 && len(m.providers) > 0 {
+		titles = []string{m.providers[0].Name()}
+	}
+	path := strings.Join(titles, " › ")
+	if runes := []rune(path); len(runes) > panelWidth-8 {
+		path = "…" + string(runes[len(runes)-(panelWidth-9):])
+	}
+	return path
+}
+
+func (m Model) renderBrowser() string {
+	if len(m.browse) == 0 {
+		if m.provLoading {
+			return dimStyle.Render(fmt.Sprintf("  Loading %s...", m.providers[0].Name()))
+		}
+		return dimStyle.Render("  Library unavailable.")
+	}
+	lvl := m.browse[len(m.browse)-1]
+	if m.provLoading {
+		return dimStyle.Render("  Loading...")
+	}
+	if len(lvl.entries) == 0 {
+		if lvl.single {
+			return dimStyle.Render("  No matches")
+		}
+		return dimStyle.Render("  Nothing here.")
+	}
+
+	visible := min(m.plVisible, len(lvl.entries))
+	scroll := max(0, lvl.cursor-visible+1)
+
+	var lines []string
+	for j := scroll; j < scroll+visible && j < len(lvl.entries); j++ {
+		e := lvl.entries[j]
+		prefix, style := "  ", playlistItemStyle
+		if j == lvl.cursor {
+			style = playlistSelectedStyle
+			prefix = "> "
+		}
+		suffix := ""
+		if e.Info != "" {
+			suffix = "  (" + e.Info + ")"
+		}
+		name := e.Name
+		if e.Track == nil {
+			name += "/"
+		} else {
+			suffix = trackBadges(*e.Track) + suffix
+		}
+		maxW := panelWidth - 2 - len([]rune(suffix))
+		if runes := []rune(name); len(runes) > maxW {
+			name = string(runes[:maxW-1]) + "…"
+		}
+		lines = append(lines, style.Render(prefix+name)+dimStyle.Render(suffix))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m Model) renderBookmarks() string {
+	marks := m.currentBookmarks()
+	if len(marks) == 0 {
+		return dimStyle.Render("  No bookmarks for this track. Press [m] to add one.")
+	}
+
+	visible := min(m.plVisible, len(marks))
+	scroll := max(0, m.bmCursor-visible+1)
+
+	lines := make([]string, 0, visible)
+	for j := scroll; j < scroll+visible && j < len(marks); j++ {
+		prefix, style := "  ", playlistItemStyle
+		if j == m.bmCursor {
+			prefix, style = "> ", playlistSelectedStyle
+		}
+		lines = append(lines, style.Render(fmt.Sprintf("%s%s  %s", prefix, formatDuration(marks[j].Position), marks[j].Name)))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (m Model) renderHelp() string {
+	if m.naming {
+		return helpStyle.Render(fmt.Sprintf("Bookmark @ %s: %s_  [Enter]Save [Esc]Cancel", formatDuration(m.namePos), m.nameInput))
+	}
+	if m.focus == focusBookmarks {
+		return helpStyle.Render("[↑↓]Navigate  [Enter]Jump  [d]Delete  [Esc]Back  [Q]Quit")
+	}
 	if m.searching {
 		query := m.searchQuery
 		count := len(m.searchResults)
 		return helpStyle.Render(fmt.Sprintf("/ %s  (%d found)  [↑↓]Navigate [Enter]Play [Esc]Cancel", query, count))
 	}
+	if m.provSearch {
+		return helpStyle.Render(fmt.Sprintf("Search %s: %s_  [Enter]Search [Esc]Cancel", m.browsingProvider().Name(), m.searchQuery))
+	}
 	if m.focus == focusProvider {
-		return helpStyle.Render("[↑↓]Navigate  [Enter]Load Playlist  [Tab]Focus  [Q]Quit")
+		if _, ok := m.browsingProvider().(playlist.Searcher); ok {
+			return helpStyle.Render("[↑↓]Nav [Enter]Open/Play [a]Queue [/]Search [Esc]Back [Tab]Focus [Q]Quit")
+		}
+		return helpStyle.Render("[↑↓]Navigate  [Enter]Open/Play  [a]Queue  [Esc]Back  [Tab]Focus  [Q]Quit")
 	}
 
 	help := "[Spc]⏯  [<>]Trk [←→]Seek [+-]Vol [e]EQ [a]Queue [/]Search "
 
 	// Conditionally show the back button if a provider is configured
-	if m.provider != nil {
+	if len(m.providers) > 0 {
 		help += "[Esc]Back "
 	}
 